@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AdditionalCA is a CA certificate Central should trust, given either inline
+// or as a path to a PEM file.
+type AdditionalCA struct {
+	// Name becomes the file name in the secret. Defaults to the file's base
+	// name, or ca-<index> for inline certificates.
+	Name string `json:"name,omitempty"`
+	PEM  string `json:"pem,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+func (a AdditionalCA) load(index int) (string, []byte, error) {
+	if (a.PEM == "") == (a.File == "") {
+		return "", nil, fmt.Errorf("additionalCAs[%d]: exactly one of pem and file must be set", index)
+	}
+
+	name := a.Name
+	data := []byte(a.PEM)
+	if a.File != "" {
+		var err error
+		data, err = os.ReadFile(a.File)
+		if err != nil {
+			return "", nil, err
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(a.File), filepath.Ext(a.File))
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("ca-%d", index)
+	}
+
+	if block, _ := pem.Decode(data); block == nil || block.Type != "CERTIFICATE" {
+		return "", nil, fmt.Errorf("additionalCAs[%d]: no PEM certificate found", index)
+	}
+
+	// update-ca-certificates only picks up .crt files
+	return name + ".crt", data, nil
+}
+
+// createAdditionalCAs creates the additional-ca secret Central mounts into its
+// trust store.
+func createAdditionalCAs(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	secret := v1.Secret{Data: map[string][]byte{}}
+	for i, ca := range cfg.AdditionalCAs {
+		name, data, err := ca.load(i)
+		if err != nil {
+			return err
+		}
+		if _, ok := secret.Data[name]; ok {
+			return fmt.Errorf("additionalCAs[%d]: duplicate name %s", i, name)
+		}
+		secret.Data[name] = data
+	}
+	secret.SetName("additional-ca")
+	markManaged("Secret", &secret)
+
+	return secretBackend.write(ctx, &secret, false)
+}
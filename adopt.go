@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// adoptedObjects are the objects a Helm or operator install has under the
+// same names the installer uses. Only these are labelled, anything else the
+// old install created is left for the user to remove.
+var adoptedObjects = map[string][]string{
+	"Deployment":            {"central", "central-db"},
+	"Service":               {"central", "central-db", "central-loadbalancer"},
+	"PersistentVolumeClaim": {"central-db"},
+	"Secret":                {"central-tls", "central-db-tls", "admin-pass", "central-htpasswd", "central-db-password", "central-license"},
+	"ConfigMap":             {"central-config", "central-endpoints", centralDbConfigMapName},
+	"Route":                 {"central", "central-mtls"},
+}
+
+// adopt implements `installer adopt`. It reads a StackRox install made with
+// Helm or the operator, prints a best-effort installer.yaml for it, and labels
+// the objects the installer would generate as its own, so the next apply
+// updates them in place.
+func adopt(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, args []string) error {
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	output := fs.String("output", "-", "file to write the inferred config to, - for stdout")
+	label := fs.Bool("label", true, "label the adopted objects as managed by the installer")
+	fs.Parse(args)
+
+	central, err := client.AppsV1().Deployments(namespace).Get(ctx, "central", metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("no central deployment in namespace %s to adopt", namespace)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case central.Annotations["meta.helm.sh/release-name"] != "":
+		log("Adopting Helm release %s", central.Annotations["meta.helm.sh/release-name"])
+		log("  uninstalling the release would delete the adopted objects, remove its release secrets instead")
+	case len(central.OwnerReferences) > 0 && central.OwnerReferences[0].Kind == "Central":
+		log("Adopting operator managed Central %s", central.OwnerReferences[0].Name)
+		log("  the operator reverts changes to the objects it owns, stop it before the next apply")
+	default:
+		log("Adopting central in namespace %s", namespace)
+	}
+
+	cfg, err := inferConfig(ctx, client, config, central.Spec.Template.Spec, central.Spec.Replicas)
+	if err != nil {
+		return err
+	}
+	data, err := configYAML(cfg)
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		fmt.Print(string(data))
+	} else {
+		err = os.WriteFile(*output, data, 0644)
+		if err != nil {
+			return err
+		}
+		log("Inferred config written to %s", *output)
+	}
+
+	if !*label {
+		return nil
+	}
+
+	return labelAdopted(ctx, config)
+}
+
+// inferConfig fills in the images, namespace, persistence and exposure of the
+// existing install. Everything else is left at the installer's defaults.
+func inferConfig(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, centralPod v1.PodSpec, replicas *int32) (*Config, error) {
+	cfg := &Config{Namespace: namespace}
+
+	for _, c := range centralPod.Containers {
+		if c.Name == "central" {
+			cfg.Images.Main = c.Image
+			if len(c.Resources.Requests) > 0 || len(c.Resources.Limits) > 0 {
+				resources := c.Resources
+				cfg.Central.Performance.Resources = &resources
+			}
+		}
+	}
+	if replicas != nil && *replicas != 1 {
+		cfg.Central.Replicas = replicas
+	}
+
+	db, err := client.AppsV1().Deployments(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, c := range db.Spec.Template.Spec.Containers {
+			if c.Name == "central-db" {
+				cfg.Images.CentralDB = c.Image
+			}
+		}
+	}
+
+	pvc, err := client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		size := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		cfg.CentralDB.Persistence = &Persistence{
+			Size:             &size,
+			StorageClassName: pvc.Spec.StorageClassName,
+		}
+	}
+
+	lb, err := client.CoreV1().Services(namespace).Get(ctx, "central-loadbalancer", metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && len(lb.Spec.Ports) > 0 {
+		switch lb.Spec.Type {
+		case v1.ServiceTypeLoadBalancer:
+			cfg.Central.Exposure.LoadBalancer = &LoadBalancerExposure{
+				Port: lb.Spec.Ports[0].Port,
+				IP:   lb.Spec.LoadBalancerIP,
+			}
+		case v1.ServiceTypeNodePort:
+			cfg.Central.Exposure.NodePort = &NodePortExposure{Port: lb.Spec.Ports[0].NodePort}
+		}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	route, err := dynamicClient.Resource(routeResource).Namespace(namespace).Get(ctx, "central", metav1.GetOptions{})
+	if err == nil {
+		host, _, _ := unstructured.NestedString(route.Object, "spec", "host")
+		termination, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "termination")
+		if termination == "" {
+			termination = "passthrough"
+		}
+		cfg.Central.Exposure.Route = &RouteExposure{Host: host, Termination: termination}
+	}
+
+	return cfg, nil
+}
+
+// configYAML renders cfg without the empty sections a plain marshal leaves
+// in.
+func configYAML(cfg *Config) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	dropEmpty(values)
+
+	return yaml.Marshal(values)
+}
+
+func dropEmpty(m map[string]interface{}) {
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			dropEmpty(sub)
+			if len(sub) == 0 {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+// labelAdopted puts the installer's labels on the adopted objects that exist.
+func labelAdopted(ctx context.Context, config *rest.Config) error {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{
+				managedByLabel: managedByValue,
+				partOfLabel:    partOfValue,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	opts := metav1.PatchOptions{}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	for _, k := range managedKinds {
+		for _, name := range adoptedObjects[k.kind] {
+			_, err = client.Resource(k.resource).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("labelling %s %s: %w", k.kind, name, err)
+			}
+			log("Labelled %s %s", k.kind, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// heavyComponents are the resource hungry apps that the anti-affinity presets
+// keep apart from each other.
+var heavyComponents = []string{"central", "central-db"}
+
+const (
+	AntiAffinityNone      = ""
+	AntiAffinityPreferred = "preferred"
+	AntiAffinityRequired  = "required"
+)
+
+// applyComponentAntiAffinity adds anti-affinity against the other heavy
+// components to a pod spec of app, on top of any configured affinity.
+func (c *Config) applyComponentAntiAffinity(spec *v1.PodSpec, app string) error {
+	if c.ComponentAntiAffinity == AntiAffinityNone {
+		return nil
+	}
+
+	var others []string
+	for _, name := range heavyComponents {
+		if name != app {
+			others = append(others, name)
+		}
+	}
+
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "app",
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   others,
+			}},
+		},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+
+	// Don't modify the affinity shared with the config
+	if spec.Affinity == nil {
+		spec.Affinity = &v1.Affinity{}
+	} else {
+		spec.Affinity = spec.Affinity.DeepCopy()
+	}
+	if spec.Affinity.PodAntiAffinity == nil {
+		spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+	}
+	anti := spec.Affinity.PodAntiAffinity
+
+	switch c.ComponentAntiAffinity {
+	case AntiAffinityPreferred:
+		anti.PreferredDuringSchedulingIgnoredDuringExecution = append(anti.PreferredDuringSchedulingIgnoredDuringExecution, v1.WeightedPodAffinityTerm{
+			Weight:          50,
+			PodAffinityTerm: term,
+		})
+	case AntiAffinityRequired:
+		anti.RequiredDuringSchedulingIgnoredDuringExecution = append(anti.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	default:
+		return fmt.Errorf("unknown componentAntiAffinity %q, expected %q or %q", c.ComponentAntiAffinity, AntiAffinityPreferred, AntiAffinityRequired)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// APIToken creates an API token through Central's API once Central is ready,
+// so automation such as CI integrations or roxctl can authenticate without
+// the admin password. The secret holds the token together with the endpoint
+// and CA needed to use it. The token is rotated when a third of its lifetime
+// is left or when it was revoked.
+type APIToken struct {
+	// Name defaults to stackrox-installer.
+	Name string `json:"name,omitempty"`
+	// Roles default to Admin.
+	Roles []string `json:"roles,omitempty"`
+	// Expiration is how long the token is valid. Defaults to 720h.
+	Expiration *metav1.Duration `json:"expiration,omitempty"`
+	// SecretName defaults to central-api-token.
+	SecretName string `json:"secretName,omitempty"`
+	// File, when set, also gets the token, readable by the owner only.
+	File string `json:"file,omitempty"`
+}
+
+func (t *APIToken) defaults() APIToken {
+	out := *t
+	if out.Name == "" {
+		out.Name = "stackrox-installer"
+	}
+	if len(out.Roles) == 0 {
+		out.Roles = []string{"Admin"}
+	}
+	if out.Expiration == nil {
+		out.Expiration = &metav1.Duration{Duration: 720 * time.Hour}
+	}
+	if out.SecretName == "" {
+		out.SecretName = "central-api-token"
+	}
+	return out
+}
+
+// createAPIToken keeps the stored token while it is valid and creates a new
+// one, revoking the old one, otherwise.
+func createAPIToken(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, cfg *Config) error {
+	conf := cfg.Central.APIToken.defaults()
+
+	api, err := newCentralAPI(ctx, client, config)
+	if err != nil {
+		return err
+	}
+	defer api.Close()
+
+	existing, err := secretBackend.read(ctx, conf.SecretName)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		valid, err := api.tokenValid(ctx, existing, conf.Expiration.Duration)
+		if err != nil {
+			return err
+		}
+		if valid {
+			log("  keeping API token %s", conf.Name)
+			// Written back unchanged so the secret stays managed by this run
+			secret := v1.Secret{Data: existing.Data}
+			secret.SetName(conf.SecretName)
+			markManaged("Secret", &secret)
+			err = secretBackend.write(ctx, &secret, false)
+			if err != nil {
+				return err
+			}
+			return writeAPITokenFile(conf.File, existing.Data["token"])
+		}
+	}
+
+	log("  creating API token %s", conf.Name)
+	var generated struct {
+		Token    string `json:"token"`
+		Metadata struct {
+			ID         string `json:"id"`
+			Expiration string `json:"expiration"`
+		} `json:"metadata"`
+	}
+	err = api.do(ctx, "POST", "/v1/apitokens/generate", map[string]interface{}{
+		"name":       conf.Name,
+		"roles":      conf.Roles,
+		"expiration": time.Now().Add(conf.Expiration.Duration).UTC().Format(time.RFC3339),
+	}, &generated)
+	if err != nil {
+		return err
+	}
+
+	centralTLS, err := client.CoreV1().Secrets(namespace).Get(ctx, "central-tls", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	secret := v1.Secret{
+		Data: map[string][]byte{
+			"token":      []byte(generated.Token),
+			"id":         []byte(generated.Metadata.ID),
+			"expiration": []byte(generated.Metadata.Expiration),
+			"endpoint":   []byte(fmt.Sprintf("central.%s.svc:443", namespace)),
+			"ca.pem":     centralTLS.Data["ca.pem"],
+		},
+	}
+	secret.SetName(conf.SecretName)
+	markManaged("Secret", &secret)
+	err = secretBackend.write(ctx, &secret, false)
+	if err != nil {
+		return err
+	}
+
+	// The old token is only revoked once the new one is stored
+	if existing != nil && len(existing.Data["id"]) > 0 && secretBackend.storesGenerated() {
+		err = api.do(ctx, "PATCH", "/v1/apitokens/revoke/"+string(existing.Data["id"]), nil, nil)
+		if err != nil {
+			log("  could not revoke the previous API token: %v", err)
+		}
+	}
+
+	return writeAPITokenFile(conf.File, []byte(generated.Token))
+}
+
+// tokenValid reports whether the token stored in secret is still known to
+// Central, not revoked, and has more than a third of lifetime left.
+func (c *centralAPI) tokenValid(ctx context.Context, secret *v1.Secret, lifetime time.Duration) (bool, error) {
+	id := string(secret.Data["id"])
+	if id == "" || len(secret.Data["token"]) == 0 {
+		return false, nil
+	}
+	expiration, err := time.Parse(time.RFC3339, string(secret.Data["expiration"]))
+	if err != nil || time.Until(expiration) < lifetime/3 {
+		return false, nil
+	}
+
+	var tokens struct {
+		Tokens []struct {
+			ID string `json:"id"`
+		} `json:"tokens"`
+	}
+	err = c.do(ctx, "GET", "/v1/apitokens?revoked=false", nil, &tokens)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tokens.Tokens {
+		if t.ID == id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func writeAPITokenFile(path string, token []byte) error {
+	if path == "" {
+		return nil
+	}
+	return os.WriteFile(path, token, 0600)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AuditLogging sends Central's audit log, a record of every API request that
+// changes state, to external destinations. Central implements this with
+// generic webhook notifiers that have audit logging turned on, so each
+// destination becomes one such notifier in the declarative config.
+type AuditLogging struct {
+	Enabled      bool                  `json:"enabled,omitempty"`
+	Destinations []AuditLogDestination `json:"destinations,omitempty"`
+}
+
+// AuditLogDestination is an HTTP(S) endpoint receiving audit events as JSON.
+type AuditLogDestination struct {
+	Name          string            `json:"name"`
+	Endpoint      string            `json:"endpoint"`
+	SkipTLSVerify bool              `json:"skipTLSVerify,omitempty"`
+	CACertPEM     string            `json:"caCertPEM,omitempty"`
+	Username      string            `json:"username,omitempty"`
+	Password      string            `json:"password,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+}
+
+// applyAuditLogging adds a notifier per audit log destination to the
+// declarative config.
+func (c *Config) applyAuditLogging() error {
+	audit := c.Central.AuditLogging
+	if !audit.Enabled {
+		return nil
+	}
+	if len(audit.Destinations) == 0 {
+		return fmt.Errorf("central.auditLogging is enabled but has no destinations")
+	}
+
+	for _, d := range audit.Destinations {
+		if d.Name == "" || d.Endpoint == "" {
+			return fmt.Errorf("central.auditLogging: every destination needs a name and an endpoint")
+		}
+		generic := map[string]interface{}{
+			"endpoint":            d.Endpoint,
+			"skipTLSVerify":       d.SkipTLSVerify,
+			"auditLoggingEnabled": true,
+		}
+		if d.CACertPEM != "" {
+			generic["caCertPEM"] = d.CACertPEM
+		}
+		if d.Username != "" {
+			generic["username"] = d.Username
+			generic["password"] = d.Password
+		}
+		// Sorted so the rendered config doesn't change between runs
+		keys := make([]string, 0, len(d.Headers))
+		for k := range d.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var headers []interface{}
+		for _, k := range keys {
+			headers = append(headers, map[string]interface{}{"key": k, "value": d.Headers[k]})
+		}
+		if len(headers) > 0 {
+			generic["headers"] = headers
+		}
+
+		c.DeclarativeConfig.Notifiers = append(c.DeclarativeConfig.Notifiers, map[string]interface{}{
+			"name":    d.Name,
+			"generic": generic,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// centralDatabase is the database Central keeps its state in.
+const centralDatabase = "central_active"
+
+// pgEnv makes the mounted central-db password available to the postgres
+// client tools run inside the central-db container.
+const pgEnv = `PGPASSWORD="$(cat /run/secrets/stackrox.io/secrets/password)" `
+
+// backupDatabase implements `installer backup`. pg_dump runs inside the
+// central-db pod and its output, which is already compressed in the custom
+// archive format, is streamed to a local file.
+func backupDatabase(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("output", fmt.Sprintf("central-db-%s.dump", time.Now().Format("20060102-150405")), "file to write the backup to")
+	fs.Parse(args)
+
+	pod, err := runningPod(ctx, client, "central-db")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log("Backing up database %s from pod %s", centralDatabase, pod)
+	cmd := pgEnv + "pg_dump -h localhost -U postgres --format=custom " + centralDatabase
+	err = execInPod(ctx, client, config, pod, "central-db", cmd, nil, f)
+	if err != nil {
+		// Don't leave a truncated backup around that looks usable
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+
+	log("Backup written to %s", *output)
+
+	return nil
+}
+
+// restoreDatabase implements `installer restore <file>`. Central is scaled
+// down for the duration of the restore so it doesn't write to tables being
+// replaced, and is scaled back to its previous replica count afterwards.
+func restoreDatabase(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: restore <file>")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pod, err := runningPod(ctx, client, "central-db")
+	if err != nil {
+		return err
+	}
+
+	deployments := client.AppsV1().Deployments(namespace)
+	scale, err := deployments.GetScale(ctx, "central", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	replicas := scale.Spec.Replicas
+
+	log("Scaling central down")
+	scale.Spec.Replicas = 0
+	_, err = deployments.UpdateScale(ctx, "central", scale, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	// Terminating central pods keep writing until they are gone
+	log("Waiting for central pods to terminate")
+	restoreErr := wait.PollUntilContextTimeout(ctx, 2*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=central"})
+		if err != nil {
+			return false, err
+		}
+		return len(pods.Items) == 0, nil
+	})
+	if restoreErr != nil {
+		restoreErr = fmt.Errorf("waiting for central pods to terminate: %w", restoreErr)
+	} else {
+		log("Restoring database %s in pod %s from %s", centralDatabase, pod, args[0])
+		cmd := pgEnv + "pg_restore -h localhost -U postgres --clean --if-exists --single-transaction -d " + centralDatabase
+		restoreErr = execInPod(ctx, client, config, pod, "central-db", cmd, f, os.Stdout)
+	}
+
+	// Bring central back even if the restore failed, it still has the old data
+	log("Scaling central back to %d replicas", replicas)
+	scale, err = deployments.GetScale(ctx, "central", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	scale.Spec.Replicas = replicas
+	_, err = deployments.UpdateScale(ctx, "central", scale, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return restoreErr
+}
+
+// execInPod runs a shell command in the given container, wiring up stdin and
+// stdout. The command's stderr is passed through to ours.
+func execInPod(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, pod, container, cmd string, stdin io.Reader, stdout io.Writer) error {
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   []string{"sh", "-c", cmd},
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: os.Stderr,
+	})
+}
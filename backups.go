@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// ExternalBackup is a Central backup integration writing to an S3 (or S3
+// compatible) or GCS bucket. Central has no declarative config for backups, so
+// these are created through its API once Central is up.
+type ExternalBackup struct {
+	Name string `json:"name"`
+	// Type is "s3" or "gcs".
+	Type         string `json:"type"`
+	Bucket       string `json:"bucket"`
+	ObjectPrefix string `json:"objectPrefix,omitempty"`
+	// Region and Endpoint only apply to s3. Endpoint is for S3 compatible
+	// stores such as MinIO.
+	Region   string `json:"region,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	// CredentialsSecret names a secret in the install namespace holding
+	// accessKeyId and secretAccessKey for s3, or serviceAccount (a JSON key)
+	// for gcs. Without it Central uses IAM or workload identity.
+	CredentialsSecret string         `json:"credentialsSecret,omitempty"`
+	Schedule          BackupSchedule `json:"schedule,omitempty"`
+	// BackupsToKeep defaults to 1 in Central.
+	BackupsToKeep int32 `json:"backupsToKeep,omitempty"`
+}
+
+// BackupSchedule is when backups run, in UTC.
+type BackupSchedule struct {
+	// Interval is "daily" (the default) or "weekly".
+	Interval string `json:"interval,omitempty"`
+	Hour     int32  `json:"hour,omitempty"`
+	Minute   int32  `json:"minute,omitempty"`
+	// Weekday is the day weekly backups run on, 0 being Sunday.
+	Weekday int32 `json:"weekday,omitempty"`
+}
+
+// apiSchedule renders the schedule the way Central's API expects it.
+func (s BackupSchedule) apiSchedule() (map[string]interface{}, error) {
+	schedule := map[string]interface{}{
+		"hour":   s.Hour,
+		"minute": s.Minute,
+	}
+	switch s.Interval {
+	case "", "daily":
+		schedule["intervalType"] = "DAILY"
+	case "weekly":
+		schedule["intervalType"] = "WEEKLY"
+		schedule["weekly"] = map[string]interface{}{"day": s.Weekday}
+	default:
+		return nil, fmt.Errorf("unknown backup interval %q, expected daily or weekly", s.Interval)
+	}
+
+	return schedule, nil
+}
+
+// apiObject builds the externalBackup object for Central's API, reading the
+// credentials from the configured secret.
+func (b ExternalBackup) apiObject(ctx context.Context, client *kubernetes.Clientset) (map[string]interface{}, error) {
+	schedule, err := b.Schedule.apiSchedule()
+	if err != nil {
+		return nil, fmt.Errorf("backup %s: %w", b.Name, err)
+	}
+	obj := map[string]interface{}{
+		"name":          b.Name,
+		"type":          b.Type,
+		"schedule":      schedule,
+		"backupsToKeep": b.BackupsToKeep,
+	}
+
+	creds := map[string][]byte{}
+	if b.CredentialsSecret != "" {
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, b.CredentialsSecret, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("backup %s: %w", b.Name, err)
+		}
+		creds = secret.Data
+	}
+
+	switch b.Type {
+	case "s3":
+		obj["s3"] = map[string]interface{}{
+			"bucket":          b.Bucket,
+			"objectPrefix":    b.ObjectPrefix,
+			"region":          b.Region,
+			"endpoint":        b.Endpoint,
+			"useIam":          b.CredentialsSecret == "",
+			"accessKeyId":     string(creds["accessKeyId"]),
+			"secretAccessKey": string(creds["secretAccessKey"]),
+		}
+	case "gcs":
+		obj["gcs"] = map[string]interface{}{
+			"bucket":         b.Bucket,
+			"objectPrefix":   b.ObjectPrefix,
+			"useWorkloadId":  b.CredentialsSecret == "",
+			"serviceAccount": string(creds["serviceAccount"]),
+		}
+	default:
+		return nil, fmt.Errorf("backup %s: unknown type %q, expected s3 or gcs", b.Name, b.Type)
+	}
+
+	return obj, nil
+}
+
+// createExternalBackups creates or updates, by name, Central's backup
+// integrations. Integrations created outside the installer are left alone.
+func createExternalBackups(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, cfg *Config) error {
+	api, err := newCentralAPI(ctx, client, config)
+	if err != nil {
+		return err
+	}
+	defer api.Close()
+
+	var existing struct {
+		ExternalBackups []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"externalBackups"`
+	}
+	err = api.do(ctx, "GET", "/v1/externalbackups", nil, &existing)
+	if err != nil {
+		return err
+	}
+	ids := map[string]string{}
+	for _, b := range existing.ExternalBackups {
+		ids[strings.ToLower(b.Name)] = b.ID
+	}
+
+	for _, b := range cfg.ExternalBackups {
+		obj, err := b.apiObject(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		id, ok := ids[strings.ToLower(b.Name)]
+		if !ok {
+			log("  creating backup integration %s", b.Name)
+			err = api.do(ctx, "POST", "/v1/externalbackups", obj, nil)
+		} else {
+			// PATCH, unlike PUT, takes the wrapped request and lets the
+			// credentials read from the secret replace the stored ones.
+			log("  updating backup integration %s", b.Name)
+			obj["id"] = id
+			err = api.do(ctx, "PATCH", "/v1/externalbackups/"+id, map[string]interface{}{
+				"externalBackup": obj,
+				"updatePassword": true,
+			}, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("backup %s: %w", b.Name, err)
+		}
+	}
+
+	return nil
+}
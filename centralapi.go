@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// centralAPI talks to Central's REST API as admin. Requests go through a
+// port-forward to a central pod, so this works however (or whether) Central
+// is exposed.
+type centralAPI struct {
+	baseURL  string
+	client   *http.Client
+	password string
+	stop     chan struct{}
+}
+
+func newCentralAPI(ctx context.Context, client *kubernetes.Clientset, config *rest.Config) (*centralAPI, error) {
+	secrets := client.CoreV1().Secrets(namespace)
+	adminPass, err := secrets.Get(ctx, "admin-pass", metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	centralTLS, err := secrets.Get(ctx, "central-tls", metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(centralTLS.Data["ca.pem"]) {
+		return nil, fmt.Errorf("central-tls has no usable ca.pem")
+	}
+
+	pod, err := runningPod(ctx, client, "central")
+	if err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	port, err := forwardPort(client, config, pod, centralAPIPort, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	return &centralAPI{
+		baseURL: fmt.Sprintf("https://127.0.0.1:%d", port),
+		client: &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				// The certificate is issued for the service name, not localhost
+				TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "central." + namespace + ".svc"},
+			},
+		},
+		password: string(adminPass.Data["password"]),
+		stop:     stop,
+	}, nil
+}
+
+func (c *centralAPI) Close() {
+	close(c.stop)
+}
+
+// do sends in as the JSON request body, if not nil, and decodes the response
+// into out, if not nil.
+func (c *centralAPI) do(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends in as the JSON request body, if not nil, and returns the
+// response of a successful request for the caller to close.
+func (c *centralAPI) send(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("admin", c.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return resp, nil
+}
+
+// forwardPort forwards a random local port to the given pod port until stop
+// is closed, and returns the local port.
+func forwardPort(client *kubernetes.Clientset, config *rest.Config, pod string, podPort int, stop chan struct{}) (uint16, error) {
+	port, _, err := startPortForward(client, config, pod, "127.0.0.1", 0, podPort, stop)
+	return port, err
+}
+
+// startPortForward forwards address:localPort, or a free port when localPort
+// is 0, to podPort of pod until stop is closed. It returns once the forward is
+// ready, along with a channel that receives the error it ended with, e.g.
+// when the pod goes away.
+func startPortForward(client *kubernetes.Clientset, config *rest.Config, pod, address string, localPort, podPort int, stop chan struct{}) (uint16, <-chan error, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return 0, nil, err
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	ready := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{address}, []string{fmt.Sprintf("%d:%d", localPort, podPort)}, stop, ready, io.Discard, os.Stderr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- fw.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+	case err := <-errs:
+		return 0, nil, fmt.Errorf("port-forward to %s: %w", pod, err)
+	}
+
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return ports[0].Local, errs, nil
+}
+
+// runningPod returns the name of a running pod of the given app.
+func runningPod(ctx context.Context, client *kubernetes.Clientset, app string) (string, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + app})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodRunning {
+			return pod.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("no running %s pod found in namespace %s", app, namespace)
+}
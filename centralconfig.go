@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// CentralSettings is rendered into the central-config.yaml Central reads from
+// the central-config ConfigMap, plus the settings Central only takes from its
+// environment.
+type CentralSettings struct {
+	Maintenance Maintenance `json:"maintenance,omitempty"`
+	// DisabledFeatures are feature flags, such as ROX_SCANNER_V4, that are
+	// turned off on Central.
+	DisabledFeatures []string  `json:"disabledFeatures,omitempty"`
+	DBPool           DBPool    `json:"dbPool,omitempty"`
+	RateLimit        RateLimit `json:"rateLimit,omitempty"`
+}
+
+// Maintenance puts Central in safe mode or forces a rollback to an earlier
+// version on the next start.
+type Maintenance struct {
+	SafeMode             bool   `json:"safeMode,omitempty"`
+	ForceRollbackVersion string `json:"forceRollbackVersion,omitempty"`
+}
+
+// DBPool sizes Central's database connection pool. Defaults to 10 and 90
+// connections.
+type DBPool struct {
+	MinConns int `json:"minConns,omitempty"`
+	MaxConns int `json:"maxConns,omitempty"`
+}
+
+// RateLimit limits the API requests Central serves.
+type RateLimit struct {
+	// PerSecond is the number of API requests per second, 0 for no limit.
+	PerSecond int `json:"perSecond,omitempty"`
+}
+
+// centralConfigKey is the central-config ConfigMap key. The ConfigMap is
+// mounted at /etc/stackrox, where Central reads central-config.yaml.
+const centralConfigKey = "central-config.yaml"
+
+// centralDBStatementTimeout is the statement_timeout, in milliseconds, of
+// Central's database connections.
+const centralDBStatementTimeout = 1200000
+
+// params returns the pool settings in the form of a libpq connection string.
+func (p DBPool) params() string {
+	minConns, maxConns := p.MinConns, p.MaxConns
+	if minConns == 0 {
+		minConns = 10
+	}
+	if maxConns == 0 {
+		maxConns = 90
+	}
+	return fmt.Sprintf("pool_min_conns=%d pool_max_conns=%d", minConns, maxConns)
+}
+
+func (s CentralSettings) validate() error {
+	if s.DBPool.MinConns < 0 || s.DBPool.MaxConns < 0 {
+		return fmt.Errorf("central.config.dbPool sizes must not be negative")
+	}
+	if s.DBPool.MaxConns > 0 && s.DBPool.MinConns > s.DBPool.MaxConns {
+		return fmt.Errorf("central.config.dbPool.minConns (%d) is larger than maxConns (%d)", s.DBPool.MinConns, s.DBPool.MaxConns)
+	}
+	if s.RateLimit.PerSecond < 0 {
+		return fmt.Errorf("central.config.rateLimit.perSecond must not be negative")
+	}
+	for _, feature := range s.DisabledFeatures {
+		if !strings.HasPrefix(feature, "ROX_") {
+			return fmt.Errorf("central.config.disabledFeatures: %q is not a feature flag, expected ROX_<NAME>", feature)
+		}
+	}
+
+	return nil
+}
+
+// Apply sets the settings Central reads from its environment.
+func (s CentralSettings) Apply(c *v1.Container) {
+	for _, feature := range s.DisabledFeatures {
+		c.Env = append(c.Env, v1.EnvVar{
+			Name:  feature,
+			Value: "false",
+		})
+	}
+	if s.RateLimit.PerSecond > 0 {
+		c.Env = append(c.Env, v1.EnvVar{
+			Name:  "ROX_CENTRAL_RATE_LIMIT_PER_SECOND",
+			Value: strconv.Itoa(s.RateLimit.PerSecond),
+		})
+	}
+}
+
+// render returns Central's central-config.yaml.
+func (s CentralSettings) render() (string, error) {
+	err := s.validate()
+	if err != nil {
+		return "", err
+	}
+
+	rollback := s.Maintenance.ForceRollbackVersion
+	if rollback == "" {
+		rollback = "none"
+	}
+	config := map[string]interface{}{
+		"maintenance": map[string]interface{}{
+			"safeMode":             s.Maintenance.SafeMode,
+			"forceRollbackVersion": rollback,
+		},
+		"centralDB": map[string]interface{}{
+			"external": false,
+			"source":   fmt.Sprintf("host=central-db.%s.svc port=5432 user=postgres sslmode=verify-full statement_timeout=%d %s client_encoding=UTF8", namespace, centralDBStatementTimeout, s.DBPool.params()),
+		},
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// createCentralConfig creates the central-config ConfigMap mounted by the
+// central deployment.
+func createCentralConfig(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	data, err := cfg.Central.Config.render()
+	if err != nil {
+		return err
+	}
+
+	cm := v1.ConfigMap{
+		Data: map[string]string{
+			centralConfigKey: data,
+		},
+	}
+	cm.SetName("central-config")
+	markManaged("ConfigMap", &cm)
+
+	return createOrUpdate(ctx, client.CoreV1().ConfigMaps(namespace), "ConfigMap", &cm)
+}
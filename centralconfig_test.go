@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestCentralConfigRender(t *testing.T) {
+	// Central only reads /etc/stackrox/central-config.yaml
+	if centralConfigKey != "central-config.yaml" {
+		t.Errorf("central-config key is %q, Central reads central-config.yaml", centralConfigKey)
+	}
+
+	tests := []struct {
+		name     string
+		settings CentralSettings
+		pool     string
+	}{
+		{
+			name: "default pool",
+			pool: "pool_min_conns=10 pool_max_conns=90",
+		},
+		{
+			name:     "configured pool",
+			settings: CentralSettings{DBPool: DBPool{MinConns: 5, MaxConns: 40}},
+			pool:     "pool_min_conns=5 pool_max_conns=40",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.settings.render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var config struct {
+				Maintenance struct {
+					SafeMode             bool   `json:"safeMode"`
+					ForceRollbackVersion string `json:"forceRollbackVersion"`
+				} `json:"maintenance"`
+				CentralDB struct {
+					External bool   `json:"external"`
+					Source   string `json:"source"`
+				} `json:"centralDB"`
+			}
+			err = yaml.UnmarshalStrict([]byte(data), &config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := fmt.Sprintf("host=central-db.%s.svc port=5432 user=postgres sslmode=verify-full statement_timeout=1200000 %s client_encoding=UTF8", namespace, tt.pool)
+			if config.CentralDB.Source != want {
+				t.Errorf("got source %q, want %q", config.CentralDB.Source, want)
+			}
+			if config.Maintenance.ForceRollbackVersion != "none" {
+				t.Errorf("got forceRollbackVersion %q, want none", config.Maintenance.ForceRollbackVersion)
+			}
+			if config.CentralDB.External {
+				t.Error("central-db is marked external")
+			}
+		})
+	}
+}
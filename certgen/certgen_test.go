@@ -0,0 +1,50 @@
+package certgen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+func deriveTestKey(t *testing.T, seed string) []byte {
+	t.Helper()
+	key, err := DeriveJWTKey(hkdf.New(sha256.New, []byte(seed), nil, []byte("jwt-key")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestDeriveJWTKey(t *testing.T) {
+	keyPEM := deriveTestKey(t, "certgen-test-seed")
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatalf("not a PEM encoded RSA private key:\n%s", keyPEM)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = key.Validate()
+	if err != nil {
+		t.Fatalf("invalid key: %v", err)
+	}
+	if bits := key.N.BitLen(); bits != 4096 {
+		t.Errorf("got a %d bit modulus, want 4096", bits)
+	}
+	if key.E != 65537 {
+		t.Errorf("got public exponent %d, want 65537", key.E)
+	}
+
+	if again := deriveTestKey(t, "certgen-test-seed"); !bytes.Equal(again, keyPEM) {
+		t.Error("the same seed derived a different key")
+	}
+	if other := deriveTestKey(t, "another-seed"); bytes.Equal(other, keyPEM) {
+		t.Error("a different seed derived the same key")
+	}
+}
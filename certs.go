@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kylape/stackrox-installer/certgen"
+)
+
+// createCertificates makes sure the TLS secrets mounted by central and
+// central-db exist. The CA is kept in central-tls (as StackRox itself does) and
+// reused on later runs; certificates are reissued from it once less than a
+// third of their validity is left.
+func createCertificates(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	var ca *certgen.CA
+	centralTLS, err := secretBackend.read(ctx, "central-tls")
+	switch {
+	case err == nil:
+		ca, err = certgen.LoadCA(centralTLS.Data["ca.pem"], centralTLS.Data["ca-key.pem"])
+		if err != nil {
+			return fmt.Errorf("loading CA from central-tls: %w", err)
+		}
+		markManaged("Secret", centralTLS)
+		if certgen.NeedsRenewal(centralTLS.Data["cert.pem"]) {
+			err = createServiceCertSecret(ctx, client, ca, "central-tls", "CENTRAL_SERVICE", "central", map[string][]byte{
+				"ca-key.pem":  centralTLS.Data["ca-key.pem"],
+				"jwt-key.pem": centralTLS.Data["jwt-key.pem"],
+			}, false)
+			if err != nil {
+				return err
+			}
+		}
+	case errors.IsNotFound(err):
+		log("Creating StackRox service CA")
+		ca, err = certgen.NewCA()
+		if err != nil {
+			return err
+		}
+		jwtKey, err := generateJWTKey(cfg)
+		if err != nil {
+			return err
+		}
+		err = createServiceCertSecret(ctx, client, ca, "central-tls", "CENTRAL_SERVICE", "central", map[string][]byte{
+			"ca-key.pem":  ca.KeyPEM,
+			"jwt-key.pem": jwtKey,
+		}, true)
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	type serviceCert struct {
+		secret, serviceType, service string
+	}
+	certs := []serviceCert{{"central-db-tls", "CENTRAL_DB_SERVICE", "central-db"}}
+	if cfg.CentralDB.ConnectionPooling != nil {
+		certs = append(certs, serviceCert{poolerTLSSecretName, "CENTRAL_DB_SERVICE", poolerName})
+	}
+	if cfg.Monitoring.enabled() {
+		certs = append(certs, serviceCert{monitoringTLSSecretName, "CENTRAL_SERVICE", "central-monitoring"})
+	}
+	for _, c := range certs {
+		existing, err := secretBackend.read(ctx, c.secret)
+		if err == nil && !certgen.NeedsRenewal(existing.Data["cert.pem"]) {
+			markManaged("Secret", existing)
+			continue
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		err = createServiceCertSecret(ctx, client, ca, c.secret, c.serviceType, c.service, nil, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createServiceCertSecret issues a certificate for service into the named
+// secret. Unless keepExisting is set, a secret holding an expiring
+// certificate is replaced.
+func createServiceCertSecret(ctx context.Context, client *kubernetes.Clientset, ca *certgen.CA, name, serviceType, service string, extra map[string][]byte, keepExisting bool) error {
+	log("Issuing %s certificate", name)
+	issued, err := ca.IssueServiceCert(serviceType, service, namespace)
+	if err != nil {
+		return err
+	}
+
+	secret := v1.Secret{
+		Data: map[string][]byte{
+			"ca.pem":   ca.CertPEM,
+			"cert.pem": issued.CertPEM,
+			"key.pem":  issued.KeyPEM,
+		},
+	}
+	for k, v := range extra {
+		secret.Data[k] = v
+	}
+	secret.SetName(name)
+	markManaged("Secret", &secret)
+	return secretBackend.write(ctx, &secret, keepExisting)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// configChecksumAnnotation holds a hash of the ConfigMaps and Secrets a pod
+// mounts. Pods read most of them only on startup, so putting the hash in the
+// pod template makes a content change roll the pods.
+const configChecksumAnnotation = "stackrox.io/config-checksum"
+
+// reloadedAtRuntime are mounted objects the component watches itself, which
+// must not restart it.
+var reloadedAtRuntime = map[string]bool{
+	declarativeConfigMapName: true,
+	declarativeSecretName:    true,
+}
+
+// addConfigChecksum annotates template with the hash of the current contents
+// of every ConfigMap and Secret its volumes reference. Optional objects that
+// don't exist are left out. Run it after the referenced objects are written.
+func addConfigChecksum(ctx context.Context, client *kubernetes.Clientset, template *v1.PodTemplateSpec) error {
+	// The same object may be mounted more than once
+	refs := map[string]func() (map[string][]byte, error){}
+	for _, vol := range template.Spec.Volumes {
+		switch {
+		case vol.ConfigMap != nil && !reloadedAtRuntime[vol.ConfigMap.Name]:
+			name := vol.ConfigMap.Name
+			refs["ConfigMap/"+name] = func() (map[string][]byte, error) {
+				return configMapData(ctx, client, name)
+			}
+		case vol.Secret != nil && !reloadedAtRuntime[vol.Secret.SecretName]:
+			name := vol.Secret.SecretName
+			refs["Secret/"+name] = func() (map[string][]byte, error) {
+				return secretData(ctx, client, name)
+			}
+		}
+	}
+	names := make([]string, 0, len(refs))
+	for ref := range refs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+
+	sum := sha256.New()
+	for _, ref := range names {
+		data, err := refs[ref]()
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		sum.Write([]byte(ref + "\n"))
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sum.Write([]byte(k + "\n"))
+			sum.Write(data[k])
+			sum.Write([]byte("\n"))
+		}
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[configChecksumAnnotation] = hex.EncodeToString(sum.Sum(nil))
+
+	return nil
+}
+
+func secretData(ctx context.Context, client *kubernetes.Clientset, name string) (map[string][]byte, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+func configMapData(ctx context.Context, client *kubernetes.Clientset, name string) (map[string][]byte, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{}
+	for k, v := range cm.Data {
+		data[k] = []byte(v)
+	}
+	for k, v := range cm.BinaryData {
+		data[k] = v
+	}
+	return data, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// With -no-cluster-scope apply only touches objects in the namespace, so it
+// works with a namespace admin's kubeconfig. The cluster scoped objects it
+// would have created are written to a file instead, for a cluster admin to
+// apply beforehand.
+var (
+	noClusterScope   bool
+	clusterScopedOut string
+)
+
+var (
+	deferredMu      sync.Mutex
+	deferredObjects []runtime.Object
+)
+
+// deferClusterScoped records obj for the cluster admin's file, if cluster
+// scoped objects are to be left alone, and tells whether it did.
+func deferClusterScoped(gvk schema.GroupVersionKind, obj runtime.Object) bool {
+	if !noClusterScope {
+		return false
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	deferredMu.Lock()
+	defer deferredMu.Unlock()
+	deferredObjects = append(deferredObjects, obj)
+	return true
+}
+
+// writeClusterScoped writes the deferred objects as a multi document YAML
+// file that kubectl apply -f accepts.
+func writeClusterScoped() error {
+	var buf bytes.Buffer
+	for _, obj := range deferredObjects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("---\n")
+		buf.Write(data)
+	}
+
+	return os.WriteFile(clusterScopedOut, buf.Bytes(), 0644)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the installer.yaml passed with -conf. Every field is optional; the
+// zero value installs the same thing the installer always has.
+type Config struct {
+	// Namespace Central is installed into. Defaults to stackrox.
+	Namespace string `json:"namespace,omitempty"`
+
+	Central   CentralConfig   `json:"central,omitempty"`
+	CentralDB CentralDBConfig `json:"centralDb,omitempty"`
+
+	Images Images `json:"images,omitempty"`
+	// Registry replaces the registry host of every image.
+	Registry string `json:"registry,omitempty"`
+	// ImageTagOverride replaces the tag (or digest) of every image.
+	ImageTagOverride string           `json:"imageTagOverride,omitempty"`
+	ImagePullPolicy  v1.PullPolicy    `json:"imagePullPolicy,omitempty"`
+	ImagePullSecrets ImagePullSecrets `json:"imagePullSecrets,omitempty"`
+
+	// License creates the central-license secret when set.
+	License *License `json:"license,omitempty"`
+
+	AdditionalCAs     []AdditionalCA    `json:"additionalCAs,omitempty"`
+	DeclarativeConfig DeclarativeConfig `json:"declarativeConfig,omitempty"`
+	// ExternalBackups are configured through Central's API after install.
+	ExternalBackups []ExternalBackup `json:"externalBackups,omitempty"`
+	// Hooks are Jobs run after Central is ready.
+	Hooks Hooks `json:"hooks,omitempty"`
+
+	NetworkPolicies NetworkPolicies `json:"networkPolicies,omitempty"`
+	Networking      Networking      `json:"networking,omitempty"`
+	Monitoring      Monitoring      `json:"monitoring,omitempty"`
+	Secrets         SecretsConfig   `json:"secrets,omitempty"`
+
+	// PriorityClass, when set, is created and used by every component.
+	PriorityClass *PriorityClass `json:"priorityClass,omitempty"`
+
+	// Generators selects what apply creates, see GeneratorFilter.
+	Generators GeneratorFilter `json:"generators,omitempty"`
+
+	// Customize adds labels and annotations to the generated objects.
+	Customize Customize `json:"customize,omitempty"`
+
+	// ComponentAntiAffinity keeps central and central-db on different nodes.
+	// It is either "preferred" or "required"; empty leaves scheduling alone.
+	ComponentAntiAffinity string `json:"componentAntiAffinity,omitempty"`
+
+	// Profile is one of demo, dev, production or hardened, see applyProfile.
+	Profile string `json:"profile,omitempty"`
+
+	// OfflineMode disables telemetry and Central's online updates in one
+	// switch, see applyOfflineMode.
+	OfflineMode bool `json:"offlineMode,omitempty"`
+
+	// Platform is one of auto, gke, eks, aks, openshift or k3s, see
+	// applyPlatform. Empty leaves everything at the Kubernetes defaults.
+	Platform string `json:"platform,omitempty"`
+
+	// HA turns on the high availability preset, see applyHAPreset. On its
+	// own it only prefers central and central-db on different nodes; Central
+	// stays at one replica without a disruption budget unless
+	// central.replicas is set above one.
+	HA bool `json:"ha,omitempty"`
+
+	// RevisionHistoryLimit is the number of old ReplicaSets kept for each
+	// deployment. Defaults to defaultRevisionHistoryLimit.
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// lock is the lock file loaded by loadLock, if any.
+	lock *LockFile
+	// snapshot is the config as written, recorded in the apply journal.
+	snapshot []byte
+}
+
+// configPaths collects the repeatable -conf flag.
+type configPaths []string
+
+var _ flag.Value = &configPaths{}
+
+func (p *configPaths) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *configPaths) Set(path string) error {
+	*p = append(*p, path)
+	return nil
+}
+
+const defaultRevisionHistoryLimit int32 = 3
+
+func (c *Config) revisionHistoryLimit() *int32 {
+	if c.RevisionHistoryLimit != nil {
+		return c.RevisionHistoryLimit
+	}
+	limit := defaultRevisionHistoryLimit
+	return &limit
+}
+
+// ComponentConfig holds the settings shared by every deployed component.
+type ComponentConfig struct {
+	Placement   Placement   `json:"placement,omitempty"`
+	PodSecurity PodSecurity `json:"podSecurity,omitempty"`
+	// PriorityClassName defaults to the generated priorityClass, if any.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	Probes            Probes `json:"probes,omitempty"`
+	// AutomountServiceAccountToken defaults to false, see
+	// applyServiceAccountToken.
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+}
+
+// CentralConfig adds the Central-only settings to the common ones.
+type CentralConfig struct {
+	ComponentConfig
+	// Replicas defaults to 1, also with the HA preset. Central has no leader
+	// election, so more replicas run several active Centrals against the
+	// same database, which is only for those who know it works for them.
+	// With the HA preset, replicas above one also get spread over nodes and
+	// zones and a disruption budget.
+	Replicas    *int32          `json:"replicas,omitempty"`
+	Exposure    Exposure        `json:"exposure,omitempty"`
+	Performance Performance     `json:"performance,omitempty"`
+	Endpoints   EndpointsConfig `json:"endpoints,omitempty"`
+	Telemetry   TelemetryConfig `json:"telemetry,omitempty"`
+	// Config is rendered into the central-config ConfigMap.
+	Config    CentralSettings `json:"config,omitempty"`
+	AdminAuth AdminAuth       `json:"adminAuth,omitempty"`
+	// APIToken creates an API token for automation after install.
+	APIToken *APIToken `json:"apiToken,omitempty"`
+	// AuditLogging is rendered into declarative config notifiers.
+	AuditLogging AuditLogging `json:"auditLogging,omitempty"`
+	// DisruptionBudget creates a PodDisruptionBudget for Central when set.
+	DisruptionBudget *DisruptionBudget `json:"disruptionBudget,omitempty"`
+}
+
+// CentralDBConfig adds the central-db only settings to the common ones.
+type CentralDBConfig struct {
+	ComponentConfig
+	// WorkloadKind is Deployment (the default) or StatefulSet. A StatefulSet
+	// gets its volume from a claim template and a stable network identity
+	// through a headless service, which copes better with rescheduling
+	// across zones.
+	WorkloadKind string `json:"workloadKind,omitempty"`
+	// ForceWorkloadKindSwitch allows switching an install whose central-db
+	// runs as a Deployment to StatefulSet, or back. The data is not
+	// migrated: a StatefulSet starts with an empty volume, and a Deployment
+	// with the central-db PVC left from before. The StatefulSet is then
+	// pruned, its disk-central-db-0 PVC is left behind.
+	ForceWorkloadKindSwitch bool `json:"forceWorkloadKindSwitch,omitempty"`
+	// Config holds postgresql.conf settings, such as shared_buffers,
+	// max_connections, work_mem or the WAL settings.
+	Config map[string]string `json:"config,omitempty"`
+	// ConnectionPooling puts a pgbouncer deployment between Central and the
+	// database when set.
+	ConnectionPooling *ConnectionPooling `json:"connectionPooling,omitempty"`
+	Persistence       *Persistence       `json:"persistence,omitempty"`
+}
+
+// Exposure selects how Central's API is reachable from outside the cluster.
+// LoadBalancer and NodePort are mutually exclusive; by default Central is only
+// reachable through its ClusterIP service.
+type Exposure struct {
+	LoadBalancer *LoadBalancerExposure `json:"loadBalancer,omitempty"`
+	NodePort     *NodePortExposure     `json:"nodePort,omitempty"`
+	Ingress      *IngressExposure      `json:"ingress,omitempty"`
+	Route        *RouteExposure        `json:"route,omitempty"`
+}
+
+type LoadBalancerExposure struct {
+	Port        int32             `json:"port,omitempty"`
+	IP          string            `json:"ip,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type NodePortExposure struct {
+	Port int32 `json:"port,omitempty"`
+}
+
+type IngressExposure struct {
+	ClassName string `json:"className,omitempty"`
+	Host      string `json:"host"`
+	TLSSecret string `json:"tlsSecret,omitempty"`
+	// Annotations default to nginx.ingress.kubernetes.io/backend-protocol:
+	// HTTPS, as Central only serves TLS. Other controllers need their own
+	// equivalent set here.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Placement controls which nodes a component's pods may be scheduled on.
+type Placement struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Tolerations  []v1.Toleration   `json:"tolerations,omitempty"`
+	Affinity     *v1.Affinity      `json:"affinity,omitempty"`
+	// TopologySpreadConstraints without a labelSelector select the
+	// component's own pods.
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+func (p Placement) Apply(template *v1.PodTemplateSpec) {
+	spec := &template.Spec
+	spec.NodeSelector = p.NodeSelector
+	spec.Tolerations = p.Tolerations
+	spec.Affinity = p.Affinity
+
+	spec.TopologySpreadConstraints = nil
+	for _, c := range p.TopologySpreadConstraints {
+		c := *c.DeepCopy()
+		if c.LabelSelector == nil {
+			c.LabelSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": template.Labels["app"]},
+			}
+		}
+		spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, c)
+	}
+}
+
+// readConfig reads the files given with -conf. Each one is deep merged over
+// the ones before it, see mergeValues, and the command line overrides are
+// applied last.
+func readConfig(paths []string, overrides []override) (*Config, error) {
+	cfg := &Config{}
+	if len(paths) > 0 || len(overrides) > 0 {
+		values := map[string]interface{}{}
+		for _, path := range paths {
+			file, err := loadConfigFile(path, nil)
+			if err != nil {
+				return nil, err
+			}
+			values = mergeValues(values, file)
+		}
+		err := applyOverrides(values, overrides)
+		if err != nil {
+			return nil, err
+		}
+		data, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.UnmarshalStrict(data, cfg)
+		if err != nil {
+			if len(paths) == 0 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %w", strings.Join(paths, ", "), err)
+		}
+	}
+
+	err := cfg.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// complete fills in everything derived from the config as written.
+func (c *Config) complete() error {
+	snapshot, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	c.snapshot = snapshot
+
+	err = c.applyProfile()
+	if err != nil {
+		return err
+	}
+	err = c.applyOfflineMode()
+	if err != nil {
+		return err
+	}
+	err = c.Networking.validate()
+	if err != nil {
+		return err
+	}
+	err = c.Central.Endpoints.validate()
+	if err != nil {
+		return err
+	}
+	err = c.Hooks.validate()
+	if err != nil {
+		return err
+	}
+	_, known := platforms[c.Platform]
+	if c.Platform != "" && c.Platform != platformAuto && !known {
+		return fmt.Errorf("unknown platform %q, expected one of: %s", c.Platform, strings.Join(platformNames(), ", "))
+	}
+	if c.HA {
+		c.applyHAPreset()
+	}
+	c.warnCentralReplicas()
+	if c.Central.AdminAuth.Disabled && len(c.ExternalBackups) > 0 {
+		return fmt.Errorf("externalBackups are configured through Central's API as admin, which needs central.adminAuth enabled")
+	}
+	if c.Central.AdminAuth.Disabled && c.Central.APIToken != nil {
+		return fmt.Errorf("central.apiToken is created through Central's API as admin, which needs central.adminAuth enabled")
+	}
+	if c.Secrets.Provider == secretProviderExternalSecrets && c.Central.APIToken != nil {
+		return fmt.Errorf("central.apiToken can't be stored with the %s secrets provider, which discards generated values", secretProviderExternalSecrets)
+	}
+
+	return c.applyAuditLogging()
+}
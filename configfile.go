@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// envReference matches ${VAR} and ${VAR:-default}. A $${...} is an escaped,
+// literal ${...}.
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate replaces environment variable references in the string values
+// of a config file. The file is parsed first and only scalar values are
+// expanded, so references in comments and keys are left alone and a value
+// can't change the structure of the file, whatever characters it holds. An
+// unquoted value is typed after expansion, like the rest of the file; quote a
+// reference, as in "${TAG}", to keep a value like 4.10 from being read as a
+// number. Referencing a variable that is unset and has no default is an
+// error, so a missing secret doesn't silently become an empty string.
+func interpolate(data []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	err := yamlv3.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	// An empty file
+	if doc.Kind == 0 {
+		return data, nil
+	}
+
+	var missing []string
+	interpolateNode(&doc, &missing)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables referenced but not set: %v", missing)
+	}
+
+	return yamlv3.Marshal(&doc)
+}
+
+func interpolateNode(node *yamlv3.Node, missing *[]string) {
+	switch node.Kind {
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		for _, n := range node.Content {
+			interpolateNode(n, missing)
+		}
+	case yamlv3.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			interpolateNode(node.Content[i], missing)
+		}
+	case yamlv3.ScalarNode:
+		if node.ShortTag() != "!!str" {
+			return
+		}
+		value, ok := expandEnv(node.Value, missing)
+		if !ok {
+			return
+		}
+		node.Value = value
+		// Dropping the tag has the value resolved again when the file is
+		// parsed, while quoted values keep their !!str tag
+		if node.Style&(yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+	}
+}
+
+// expandEnv expands the references in s, returning false when it has none.
+func expandEnv(s string, missing *[]string) (string, bool) {
+	found := false
+	out := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		found = true
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+		m := envReference.FindStringSubmatch(ref)
+		if value, ok := os.LookupEnv(m[1]); ok {
+			return value
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		*missing = append(*missing, m[1])
+		return ref
+	})
+
+	return out, found
+}
+
+// loadConfigFile reads one config file into a generic map, after decrypting
+// it if it is SOPS encrypted, interpolating environment variables and merging
+// in the files listed under its include key. Includes are relative to the
+// including file and are overridden by it; later includes override earlier
+// ones.
+func loadConfigFile(path string, including []string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range including {
+		if p == abs {
+			return nil, fmt.Errorf("%s includes itself", path)
+		}
+	}
+	including = append(including, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isSOPSEncrypted(data) {
+		data, err = decryptSOPS(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err = interpolate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var file struct {
+		Include []string `json:"include,omitempty"`
+	}
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := map[string]interface{}{}
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	delete(values, "include")
+
+	merged := map[string]interface{}{}
+	for _, inc := range file.Include {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		included, err := loadConfigFile(inc, including)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeValues(merged, included)
+	}
+
+	return mergeValues(merged, values), nil
+}
+
+// mergeValues deep merges override into base. Maps are merged key by key;
+// anything else, lists included, is replaced.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	for k, v := range override {
+		if vm, ok := v.(map[string]interface{}); ok {
+			if bm, ok := base[k].(map[string]interface{}); ok {
+				base[k] = mergeValues(bm, vm)
+				continue
+			}
+		}
+		base[k] = v
+	}
+
+	return base
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TAG", "4.10")
+	t.Setenv("TRICKY", "a # b: c\nd: e")
+	t.Setenv("ALIAS", "*ref")
+	t.Setenv("QUOTES", `it's "quoted"`)
+	t.Setenv("ON", "true")
+
+	tests := []struct {
+		name string
+		in   string
+		want map[string]interface{}
+	}{
+		{
+			name: "quoted reference stays a string",
+			in:   `tag: "${TAG}"`,
+			want: map[string]interface{}{"tag": "4.10"},
+		},
+		{
+			name: "unquoted reference is typed",
+			in:   "tag: ${TAG}\nenabled: ${ON}",
+			want: map[string]interface{}{"tag": 4.1, "enabled": true},
+		},
+		{
+			name: "part of a value",
+			in:   "image: quay.io/stackrox/main:${TAG}",
+			want: map[string]interface{}{"image": "quay.io/stackrox/main:4.10"},
+		},
+		{
+			name: "special characters can't change the structure",
+			in:   "a: ${TRICKY}\nb: ${ALIAS}\nc: ${QUOTES}",
+			want: map[string]interface{}{
+				"a": "a # b: c\nd: e",
+				"b": "*ref",
+				"c": `it's "quoted"`,
+			},
+		},
+		{
+			name: "default",
+			in:   "a: ${INTERPOLATE_UNSET:-fallback}",
+			want: map[string]interface{}{"a": "fallback"},
+		},
+		{
+			name: "escaped reference",
+			in:   "a: $${TAG}",
+			want: map[string]interface{}{"a": "${TAG}"},
+		},
+		{
+			name: "comments and keys are left alone",
+			in:   "# ${INTERPOLATE_UNSET}\n${TAG}: x # ${INTERPOLATE_UNSET}",
+			want: map[string]interface{}{"${TAG}": "x"},
+		},
+		{
+			name: "lists",
+			in:   "a:\n- ${TAG}\n- b",
+			want: map[string]interface{}{"a": []interface{}{4.1, "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := interpolate([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]interface{}{}
+			err = yaml.Unmarshal(out, &got)
+			if err != nil {
+				t.Fatalf("%v in:\n%s", err, out)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateMissing(t *testing.T) {
+	_, err := interpolate([]byte("a: ${INTERPOLATE_UNSET}"))
+	if err == nil {
+		t.Fatal("expected an error for an unset variable")
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{
+			name:     "maps are merged key by key",
+			base:     "central: {replicas: 1, exposure: {nodePort: {port: 30000}}}",
+			override: "central: {exposure: {loadBalancer: {port: 443}}}",
+			want:     "central: {replicas: 1, exposure: {nodePort: {port: 30000}, loadBalancer: {port: 443}}}",
+		},
+		{
+			name:     "scalars are replaced",
+			base:     "profile: dev\nplatform: auto",
+			override: "profile: production",
+			want:     "profile: production\nplatform: auto",
+		},
+		{
+			name:     "lists are replaced, not appended to",
+			base:     "additionalCAs: [{name: a}, {name: b}]",
+			override: "additionalCAs: [{name: c}]",
+			want:     "additionalCAs: [{name: c}]",
+		},
+		{
+			name:     "null replaces a map",
+			base:     "centralDb: {persistence: {size: 10Gi}}",
+			override: "centralDb: {persistence: null}",
+			want:     "centralDb: {persistence: null}",
+		},
+		{
+			name:     "a map replaces null",
+			base:     "centralDb: {persistence: null}",
+			override: "centralDb: {persistence: {size: 10Gi}}",
+			want:     "centralDb: {persistence: {size: 10Gi}}",
+		},
+		{
+			name:     "a map replaces a scalar",
+			base:     "central: x",
+			override: "central: {replicas: 1}",
+			want:     "central: {replicas: 1}",
+		},
+		{
+			name:     "a scalar replaces a map",
+			base:     "central: {replicas: 1}",
+			override: "central: x",
+			want:     "central: x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeValues(parseValues(t, tt.base), parseValues(t, tt.override))
+			want := parseValues(t, tt.want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func parseValues(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	values := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(s), &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Customize adds labels and annotations to generated objects, for things like
+// cost allocation, sidecar injection or policy engines. Labels and
+// annotations the installer sets itself, such as the app label selectors rely
+// on, always win.
+type Customize struct {
+	// Labels and Annotations go on every object.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Deployments also applies to StatefulSets.
+	Deployments Metadata `json:"deployments,omitempty"`
+	Services    Metadata `json:"services,omitempty"`
+	// Pods applies to the pod templates of every workload.
+	Pods Metadata `json:"pods,omitempty"`
+}
+
+// Metadata is a set of labels and annotations.
+type Metadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// customization is set from the config before any objects are generated.
+var customization Customize
+
+func (c Customize) apply(kind string, obj metav1.Object) {
+	switch kind {
+	case "Deployment", "StatefulSet":
+		addMetadata(obj, c.Deployments.Labels, c.Deployments.Annotations)
+	case "Service":
+		addMetadata(obj, c.Services.Labels, c.Services.Annotations)
+	}
+	addMetadata(obj, c.Labels, c.Annotations)
+
+	switch o := obj.(type) {
+	case *apps.Deployment:
+		addMetadata(&o.Spec.Template, c.Pods.Labels, c.Pods.Annotations)
+	case *apps.StatefulSet:
+		addMetadata(&o.Spec.Template, c.Pods.Labels, c.Pods.Annotations)
+	}
+}
+
+// addMetadata sets the given labels and annotations on obj without replacing
+// ones already there.
+func addMetadata(obj metav1.Object, labels, annotations map[string]string) {
+	if len(labels) > 0 {
+		obj.SetLabels(mergeMissing(obj.GetLabels(), labels))
+	}
+	if len(annotations) > 0 {
+		obj.SetAnnotations(mergeMissing(obj.GetAnnotations(), annotations))
+	}
+}
+
+func mergeMissing(dst, src map[string]string) map[string]string {
+	if dst == nil {
+		dst = map[string]string{}
+	}
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
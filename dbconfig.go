@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	centralDbConfigMapName = "central-db-config"
+	centralDbConfigFile    = "/etc/stackrox.d/config/postgresql.conf"
+)
+
+// renderPostgresConf renders the centralDb.config settings as postgresql.conf.
+// A config file passed to postgres replaces the one in the data directory,
+// so that one is included first to keep the settings initdb and the image
+// put there, and the ones the image relies on are set again.
+func renderPostgresConf(settings map[string]string) string {
+	var b strings.Builder
+	b.WriteString("# Generated by stackrox-installer from centralDb.config\n")
+	b.WriteString("include_if_exists = '/var/lib/postgresql/data/pgdata/postgresql.conf'\n")
+	b.WriteString("listen_addresses = '*'\n")
+	b.WriteString("hba_file = '/var/lib/postgresql/data/pgdata/pg_hba.conf'\n")
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = '%s'\n", k, strings.ReplaceAll(settings[k], "'", "''"))
+	}
+
+	return b.String()
+}
+
+// createCentralDbConfig creates the central-db-config ConfigMap mounted into
+// central-db.
+func createCentralDbConfig(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	cm := v1.ConfigMap{
+		Data: map[string]string{
+			"postgresql.conf": renderPostgresConf(cfg.CentralDB.Config),
+		},
+	}
+	cm.SetName(centralDbConfigMapName)
+	markManaged("ConfigMap", &cm)
+
+	return createOrUpdate(ctx, client.CoreV1().ConfigMaps(namespace), "ConfigMap", &cm)
+}
+
+// applyPostgresConf points postgres at the generated config file. Without
+// any settings the image's own config is left in use.
+func (c CentralDBConfig) applyPostgresConf(container *v1.Container) {
+	if len(c.Config) == 0 {
+		return
+	}
+	container.Args = append(container.Args, "-c", "config_file="+centralDbConfigFile)
+}
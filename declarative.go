@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// DeclarativeConfig holds Central declarative configuration objects in the
+// same format Central reads them. Objects that may carry credentials (auth
+// providers and notifiers) are rendered into a Secret, the rest into a
+// ConfigMap.
+type DeclarativeConfig struct {
+	AuthProviders  []map[string]interface{} `json:"authProviders,omitempty"`
+	PermissionSets []map[string]interface{} `json:"permissionSets,omitempty"`
+	AccessScopes   []map[string]interface{} `json:"accessScopes,omitempty"`
+	Roles          []map[string]interface{} `json:"roles,omitempty"`
+	Notifiers      []map[string]interface{} `json:"notifiers,omitempty"`
+}
+
+const (
+	declarativeConfigMountPath = "/run/stackrox.io/declarative-configuration/"
+	declarativeConfigMapName   = "declarative-configs"
+	declarativeSecretName      = "declarative-configs-sensitive"
+)
+
+func (d DeclarativeConfig) empty() bool {
+	return len(d.AuthProviders)+len(d.PermissionSets)+len(d.AccessScopes)+len(d.Roles)+len(d.Notifiers) == 0
+}
+
+// renderDeclarativeObjects returns the objects as a multi-document YAML file.
+func renderDeclarativeObjects(objects []map[string]interface{}) (string, error) {
+	docs := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, string(data))
+	}
+
+	return strings.Join(docs, "---\n"), nil
+}
+
+func createDeclarativeConfig(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	conf := cfg.DeclarativeConfig
+
+	plain := map[string]string{}
+	sensitive := map[string]string{}
+	for _, file := range []struct {
+		name    string
+		objects []map[string]interface{}
+		target  map[string]string
+	}{
+		{"auth-providers.yaml", conf.AuthProviders, sensitive},
+		{"notifiers.yaml", conf.Notifiers, sensitive},
+		{"permission-sets.yaml", conf.PermissionSets, plain},
+		{"access-scopes.yaml", conf.AccessScopes, plain},
+		{"roles.yaml", conf.Roles, plain},
+	} {
+		if len(file.objects) == 0 {
+			continue
+		}
+		content, err := renderDeclarativeObjects(file.objects)
+		if err != nil {
+			return err
+		}
+		file.target[file.name] = content
+	}
+
+	cm := v1.ConfigMap{Data: plain}
+	cm.SetName(declarativeConfigMapName)
+	markManaged("ConfigMap", &cm)
+	err := createOrUpdate(ctx, client.CoreV1().ConfigMaps(namespace), "ConfigMap", &cm)
+	if err != nil {
+		return err
+	}
+
+	secret := v1.Secret{StringData: sensitive}
+	secret.SetName(declarativeSecretName)
+	markManaged("Secret", &secret)
+	return secretBackend.write(ctx, &secret, false)
+}
+
+// declarativeConfigVolumes mounts the rendered declarative configuration into
+// Central, one directory per ConfigMap/Secret as Central expects.
+func declarativeConfigVolumes() []VolumeDefAndMount {
+	return []VolumeDefAndMount{
+		{
+			Name:      "declarative-configs",
+			MountPath: declarativeConfigMountPath + declarativeConfigMapName,
+			ReadOnly:  true,
+			Volume: v1.Volume{
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{
+						LocalObjectReference: v1.LocalObjectReference{
+							Name: declarativeConfigMapName,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:      "declarative-configs-sensitive",
+			MountPath: declarativeConfigMountPath + declarativeSecretName,
+			ReadOnly:  true,
+			Volume: v1.Volume{
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: declarativeSecretName,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// The dev environment is a kind cluster wired to a registry container on
+// localhost:5001, following kind's local registry setup, so locally built
+// images can be pushed there and set with registry: localhost:5001.
+const (
+	devRegistryName = "kind-registry"
+	devRegistryPort = "5001"
+)
+
+// kindConfig makes containerd read registry hosts from config_path, where
+// devRegistryHosts is written into each node.
+const kindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+containerdConfigPatches:
+- |-
+  [plugins."io.containerd.grpc.v1.cri".registry]
+    config_path = "/etc/containerd/certs.d"
+`
+
+// devRegistryHosts lets the nodes pull localhost:5001 images from the
+// registry container over the kind network.
+const devRegistryHosts = `[host."http://` + devRegistryName + `:5000"]
+`
+
+// localRegistryHosting advertises the registry to tools that look for it, see
+// KEP-1755.
+const localRegistryHosting = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "localhost:` + devRegistryPort + `"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+`
+
+// devCommand implements `installer dev up|down`.
+func devCommand(ctx context.Context, cfg *Config, prune bool, waitTimeout time.Duration, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: dev up|down [--name <cluster>]")
+	}
+	fs := flag.NewFlagSet("dev", flag.ExitOnError)
+	name := fs.String("name", "stackrox", "name of the kind cluster")
+	skipLoad := fs.Bool("skip-load", false, "don't pre-load the configured images into the cluster")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "up":
+		return devUp(ctx, cfg, *name, !*skipLoad, prune, waitTimeout)
+	case "down":
+		log("Deleting kind cluster %s", *name)
+		return run("kind", "delete", "cluster", "--name", *name)
+	}
+
+	return fmt.Errorf("unknown dev action %q", args[0])
+}
+
+func devUp(ctx context.Context, cfg *Config, name string, load, prune bool, waitTimeout time.Duration) error {
+	for _, tool := range []string{"docker", "kind", "kubectl"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("dev up needs %s in PATH", tool)
+		}
+	}
+
+	if exec.Command("docker", "inspect", devRegistryName).Run() != nil {
+		log("Starting local registry on localhost:%s", devRegistryPort)
+		err := run("docker", "run", "-d", "--restart=always", "-p", "127.0.0.1:"+devRegistryPort+":5000", "--network", "bridge", "--name", devRegistryName, "registry:2")
+		if err != nil {
+			return err
+		}
+	}
+
+	clusters, err := exec.Command("kind", "get", "clusters").Output()
+	if err != nil {
+		return err
+	}
+	if !contains(strings.Fields(string(clusters)), name) {
+		log("Creating kind cluster %s", name)
+		cmd := exec.Command("kind", "create", "cluster", "--name", name, "--config", "-")
+		cmd.Stdin = strings.NewReader(kindConfig)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fails when the registry is connected already, which is fine
+	_ = exec.Command("docker", "network", "connect", "kind", devRegistryName).Run()
+
+	nodes, err := exec.Command("kind", "get", "nodes", "--name", name).Output()
+	if err != nil {
+		return err
+	}
+	hostsDir := "/etc/containerd/certs.d/localhost:" + devRegistryPort
+	for _, node := range strings.Fields(string(nodes)) {
+		err = run("docker", "exec", node, "mkdir", "-p", hostsDir)
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command("docker", "exec", "-i", node, "cp", "/dev/stdin", hostsDir+"/hosts.toml")
+		cmd.Stdin = strings.NewReader(devRegistryHosts)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		err = cmd.Run()
+		if err != nil {
+			return err
+		}
+	}
+
+	kubeContext := "kind-" + name
+	cmd := exec.Command("kubectl", "--context", kubeContext, "apply", "-f", "-")
+	cmd.Stdin = strings.NewReader(localRegistryHosting)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	if load {
+		err = loadImages(cfg, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	apply(ctx, clientset, config, cfg, prune, waitTimeout)
+	log("Central is installed in kind cluster %s, use installer port-forward to reach it", name)
+
+	return nil
+}
+
+// loadImages copies the configured images into the kind nodes, so the first
+// install doesn't wait on pulls. Images in the local registry are pulled from
+// there by the nodes.
+func loadImages(cfg *Config, cluster string) error {
+	refs := cfg.imageRefs()
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ref := refs[name]
+		if strings.HasPrefix(ref, "localhost:"+devRegistryPort+"/") {
+			continue
+		}
+		if exec.Command("docker", "image", "inspect", ref).Run() != nil {
+			log("Pulling %s", ref)
+			err := run("docker", "pull", ref)
+			if err != nil {
+				return err
+			}
+		}
+		log("Loading %s into %s", ref, cluster)
+		err := run("kind", "load", "docker-image", ref, "--name", cluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// egressEndpoint is an external host the installed deployment, or the
+// installer itself, connects to.
+type egressEndpoint struct {
+	// Source is what opens the connection: kubelet for image pulls, central,
+	// or installer.
+	Source  string `json:"source"`
+	Host    string `json:"host"`
+	Port    string `json:"port"`
+	Purpose string `json:"purpose"`
+}
+
+// registryBlobHosts are the hosts registries redirect layer downloads to.
+var registryBlobHosts = map[string][]string{
+	"quay.io":   {"cdn01.quay.io", "cdn02.quay.io", "cdn03.quay.io"},
+	"docker.io": {"auth.docker.io", "production.cloudflare.docker.com"},
+}
+
+// printEgressEndpoints implements `installer endpoints`, listing every
+// external endpoint the configured deployment will contact so that firewalls
+// can be opened up front.
+func printEgressEndpoints(cfg *Config, args []string) error {
+	fs := flag.NewFlagSet("endpoints", flag.ExitOnError)
+	output := fs.String("output", "table", "output format, table, json or csv")
+	fs.Parse(args)
+
+	endpoints, err := cfg.egressEndpoints()
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(endpoints)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"source", "host", "port", "purpose"})
+		for _, e := range endpoints {
+			w.Write([]string{e.Source, e.Host, e.Port, e.Purpose})
+		}
+		w.Flush()
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SOURCE\tHOST\tPORT\tPURPOSE")
+		for _, e := range endpoints {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Source, e.Host, e.Port, e.Purpose)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, expected table, json or csv", *output)
+	}
+}
+
+// egressEndpoints derives the external endpoints from the config, sorted and
+// without duplicates.
+func (c *Config) egressEndpoints() ([]egressEndpoint, error) {
+	seen := map[egressEndpoint]bool{}
+	var endpoints []egressEndpoint
+	add := func(e egressEndpoint) {
+		if !seen[e] {
+			seen[e] = true
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	components := []string{"main", "centralDb"}
+	if c.CentralDB.ConnectionPooling != nil {
+		components = append(components, "pgbouncer")
+	}
+	for _, component := range components {
+		name, _, _ := splitImage(c.pinnedImage(component))
+		registry := "docker.io"
+		if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+			registry = name[:i]
+		}
+		host, port := splitHostPortDefault(registry, "443")
+		if registry == "docker.io" {
+			host = "registry-1.docker.io"
+		}
+		add(egressEndpoint{Source: "kubelet", Host: host, Port: port, Purpose: "pull " + component + " image"})
+		for _, blobHost := range registryBlobHosts[registry] {
+			add(egressEndpoint{Source: "kubelet", Host: blobHost, Port: "443", Purpose: "pull " + component + " image layers"})
+		}
+	}
+
+	if !c.OfflineMode {
+		add(egressEndpoint{Source: "central", Host: "definitions.stackrox.io", Port: "443", Purpose: "vulnerability definitions"})
+		add(egressEndpoint{Source: "central", Host: "collector-modules.stackrox.io", Port: "443", Purpose: "collector probe mirror"})
+	}
+	if c.Central.Telemetry.Enabled == nil || *c.Central.Telemetry.Enabled {
+		add(egressEndpoint{Source: "central", Host: "console.redhat.com", Port: "443", Purpose: "telemetry"})
+	}
+
+	for _, b := range c.ExternalBackups {
+		host := "storage.googleapis.com"
+		if b.Type == "s3" {
+			host = "s3.amazonaws.com"
+			if b.Region != "" {
+				host = fmt.Sprintf("s3.%s.amazonaws.com", b.Region)
+			}
+		}
+		port := "443"
+		if b.Endpoint != "" {
+			var err error
+			host, port, err = urlHostPort(b.Endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("external backup %s: %w", b.Name, err)
+			}
+		}
+		add(egressEndpoint{Source: "central", Host: host, Port: port, Purpose: "external backup " + b.Name})
+	}
+
+	if c.Central.AuditLogging.Enabled {
+		for _, d := range c.Central.AuditLogging.Destinations {
+			host, port, err := urlHostPort(d.Endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("audit log destination %s: %w", d.Name, err)
+			}
+			add(egressEndpoint{Source: "central", Host: host, Port: port, Purpose: "audit log destination " + d.Name})
+		}
+	}
+
+	if c.Secrets.Provider == secretProviderVault && c.Secrets.Vault != nil {
+		host, port, err := urlHostPort(c.Secrets.Vault.Address)
+		if err != nil {
+			return nil, fmt.Errorf("secrets.vault.address: %w", err)
+		}
+		add(egressEndpoint{Source: "installer", Host: host, Port: port, Purpose: "store generated secrets in Vault"})
+	}
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if endpoints[i].Source != endpoints[j].Source {
+			return endpoints[i].Source < endpoints[j].Source
+		}
+		return endpoints[i].Host < endpoints[j].Host
+	})
+
+	return endpoints, nil
+}
+
+// urlHostPort returns the host and port of an http(s) URL, filling in the
+// scheme's default port.
+func urlHostPort(raw string) (string, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("%q has no host", raw)
+	}
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	host, port := splitHostPortDefault(u.Host, port)
+
+	return host, port, nil
+}
+
+// splitHostPortDefault splits hostport, using port when it has none.
+func splitHostPortDefault(hostport, port string) (string, string) {
+	host, p, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.Trim(hostport, "[]"), port
+	}
+	return host, p
+}
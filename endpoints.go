@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// EndpointsConfig is Central's endpoints.yaml, describing the listeners Central
+// opens besides (or instead of) the default one on 8443. Their ports are added
+// to the central service and network policy.
+type EndpointsConfig struct {
+	DisableDefault bool             `json:"disableDefault,omitempty"`
+	Endpoints      []EndpointConfig `json:"endpoints,omitempty"`
+}
+
+type EndpointConfig struct {
+	Listen    string      `json:"listen"`
+	Protocols []string    `json:"protocols,omitempty"`
+	TLS       EndpointTLS `json:"tls,omitempty"`
+}
+
+type EndpointTLS struct {
+	Disable bool `json:"disable,omitempty"`
+	// ServerCertificates is serverCerts in Central's endpoints.yaml.
+	ServerCertificates []string           `json:"serverCertificates,omitempty"`
+	ClientAuth         EndpointClientAuth `json:"clientAuth,omitempty"`
+}
+
+// centralEndpoints is EndpointsConfig the way Central's endpoints.yaml names
+// it, which the config keeps apart from so it can spell things out.
+type centralEndpoints struct {
+	DisableDefault bool              `json:"disableDefault,omitempty"`
+	Endpoints      []centralEndpoint `json:"endpoints,omitempty"`
+}
+
+type centralEndpoint struct {
+	Listen    string             `json:"listen"`
+	Protocols []string           `json:"protocols,omitempty"`
+	TLS       centralEndpointTLS `json:"tls,omitempty"`
+}
+
+type centralEndpointTLS struct {
+	Disable     bool               `json:"disable,omitempty"`
+	ServerCerts []string           `json:"serverCerts,omitempty"`
+	ClientAuth  EndpointClientAuth `json:"clientAuth,omitempty"`
+}
+
+type EndpointClientAuth struct {
+	Required        bool     `json:"required,omitempty"`
+	CertAuthorities []string `json:"certAuthorities,omitempty"`
+}
+
+// centralAPIPort is the default listener, which the probes, the central
+// service and the installer's own API calls use.
+const centralAPIPort = 8443
+
+// endpointPort returns the port of a listen address, which is either a port
+// or host:port.
+func endpointPort(listen string) (int32, error) {
+	port := listen
+	if strings.Contains(listen, ":") {
+		var err error
+		_, port, err = net.SplitHostPort(listen)
+		if err != nil {
+			return 0, fmt.Errorf("endpoint listen address %q: %w", listen, err)
+		}
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("endpoint listen address %q: invalid port", listen)
+	}
+
+	return int32(n), nil
+}
+
+// ports returns the ports of the configured listeners other than the default
+// one, in order.
+func (e EndpointsConfig) ports() ([]int32, error) {
+	var ports []int32
+	seen := map[int32]bool{centralAPIPort: true}
+	for _, endpoint := range e.Endpoints {
+		port, err := endpointPort(endpoint.Listen)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+
+	return ports, nil
+}
+
+// validate requires a TLS listener on the default port when the default one
+// is disabled, as everything talking to Central expects it there.
+func (e EndpointsConfig) validate() error {
+	replaced := false
+	for _, endpoint := range e.Endpoints {
+		port, err := endpointPort(endpoint.Listen)
+		if err != nil {
+			return err
+		}
+		replaced = replaced || port == centralAPIPort && !endpoint.TLS.Disable
+	}
+	if e.DisableDefault && !replaced {
+		return fmt.Errorf("central.endpoints.disableDefault needs an endpoint serving TLS on %d in its place", centralAPIPort)
+	}
+
+	return nil
+}
+
+// endpointPortName names the container and service port of a listener.
+func endpointPortName(port int32) string {
+	return fmt.Sprintf("endpoint-%d", port)
+}
+
+// TelemetryConfig controls Central's usage telemetry.
+type TelemetryConfig struct {
+	// Enabled defaults to true, matching Central.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+func (t TelemetryConfig) Apply(c *v1.Container) {
+	if t.Enabled != nil && !*t.Enabled {
+		c.Env = append(c.Env, v1.EnvVar{
+			Name:  "ROX_TELEMETRY_STORAGE_KEY_V1",
+			Value: "DISABLED",
+		})
+	}
+}
+
+// createCentralEndpoints creates the central-endpoints ConfigMap mounted by
+// the central deployment.
+func createCentralEndpoints(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	endpoints := centralEndpoints{
+		DisableDefault: cfg.Central.Endpoints.DisableDefault,
+	}
+	for _, e := range cfg.Central.Endpoints.Endpoints {
+		listen, err := cfg.Networking.listenAddress(e.Listen)
+		if err != nil {
+			return err
+		}
+		endpoints.Endpoints = append(endpoints.Endpoints, centralEndpoint{
+			Listen:    listen,
+			Protocols: e.Protocols,
+			TLS: centralEndpointTLS{
+				Disable:     e.TLS.Disable,
+				ServerCerts: e.TLS.ServerCertificates,
+				ClientAuth:  e.TLS.ClientAuth,
+			},
+		})
+	}
+	data, err := yaml.Marshal(endpoints)
+	if err != nil {
+		return err
+	}
+
+	cm := v1.ConfigMap{
+		Data: map[string]string{
+			"endpoints.yaml": string(data),
+		},
+	}
+	cm.SetName("central-endpoints")
+	markManaged("ConfigMap", &cm)
+
+	return createOrUpdate(ctx, client.CoreV1().ConfigMaps(namespace), "ConfigMap", &cm)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// exportBundle implements `installer export --format roxctl-bundle`. The
+// bundle is the one `roxctl sensor generate` writes: Central registers the
+// cluster and renders the sensor manifests, certificates and scripts, so
+// clusters secured with either tool look the same to Central.
+func exportBundle(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, cfg *Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "roxctl-bundle", "bundle format, only roxctl-bundle is supported")
+	clusterName := fs.String("cluster-name", "", "name of the secured cluster, registered with Central unless it exists")
+	clusterType := fs.String("cluster-type", "", "k8s or openshift, defaults to openshift with platform openshift and k8s otherwise")
+	centralEndpoint := fs.String("central-endpoint", "", "endpoint sensor connects to, defaults to Central's service")
+	output := fs.String("output", "", "file to write the bundle to, defaults to sensor-<cluster-name>.zip")
+	fs.Parse(args)
+
+	if *format != "roxctl-bundle" {
+		return fmt.Errorf("unknown export format %q, only roxctl-bundle is supported", *format)
+	}
+	if *clusterName == "" {
+		return fmt.Errorf("usage: export --format roxctl-bundle --cluster-name <name> [--cluster-type k8s|openshift] [--central-endpoint <host:port>] [--output <file>]")
+	}
+
+	apiType := "KUBERNETES_CLUSTER"
+	switch *clusterType {
+	case "":
+		if cfg.Platform == "openshift" {
+			apiType = "OPENSHIFT4_CLUSTER"
+		}
+	case "k8s":
+	case "openshift":
+		apiType = "OPENSHIFT4_CLUSTER"
+	default:
+		return fmt.Errorf("unknown cluster type %q, expected k8s or openshift", *clusterType)
+	}
+	endpoint := *centralEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("central.%s.svc:443", namespace)
+	}
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("sensor-%s.zip", *clusterName)
+	}
+
+	api, err := newCentralAPI(ctx, client, config)
+	if err != nil {
+		return err
+	}
+	defer api.Close()
+
+	id, err := api.clusterID(ctx, *clusterName)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		log("Registering cluster %s with Central", *clusterName)
+		var created struct {
+			Cluster struct {
+				ID string `json:"id"`
+			} `json:"cluster"`
+		}
+		// The defaults roxctl sensor generate uses. Like roxctl, only the
+		// main image repository is passed; Central adds its own version.
+		mainRepository, _, _ := splitImage(cfg.mainImage())
+		err = api.do(ctx, "POST", "/v1/clusters", map[string]interface{}{
+			"name":                       *clusterName,
+			"type":                       apiType,
+			"mainImage":                  mainRepository,
+			"centralApiEndpoint":         endpoint,
+			"runtimeSupport":             true,
+			"collectionMethod":           "CORE_BPF",
+			"admissionController":        true,
+			"admissionControllerUpdates": true,
+			"tolerationsConfig": map[string]interface{}{
+				"disabled": false,
+			},
+		}, &created)
+		if err != nil {
+			return err
+		}
+		id = created.Cluster.ID
+	} else {
+		log("Cluster %s is already registered with Central", *clusterName)
+	}
+
+	resp, err := api.send(ctx, "POST", "/api/extensions/clusters/zip", map[string]interface{}{
+		"id":               id,
+		"createUpgraderSA": true,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The bundle holds the sensor's private keys
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	log("Sensor bundle for %s written to %s", *clusterName, path)
+
+	return nil
+}
+
+// clusterID returns the ID of the cluster registered under name, or an empty
+// string.
+func (c *centralAPI) clusterID(ctx context.Context, name string) (string, error) {
+	var clusters struct {
+		Clusters []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"clusters"`
+	}
+	err := c.do(ctx, "GET", "/v1/clusters?query="+url.QueryEscape("Cluster:"+name), nil, &clusters)
+	if err != nil {
+		return "", err
+	}
+	for _, cluster := range clusters.Clusters {
+		if cluster.Name == name {
+			return cluster.ID, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// createCentralServices creates the in-cluster central service and, when
+// configured, the central-loadbalancer service exposing it externally.
+func createCentralServices(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	svc := v1.Service{
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{
+				"app": "central",
+			},
+			Ports: []v1.ServicePort{{
+				Name:       "https",
+				Port:       443,
+				TargetPort: intstr.FromString("api"),
+			}},
+		},
+	}
+	endpointPorts, err := cfg.Central.Endpoints.ports()
+	if err != nil {
+		return err
+	}
+	for _, port := range endpointPorts {
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{
+			Name:       endpointPortName(port),
+			Port:       port,
+			TargetPort: intstr.FromString(endpointPortName(port)),
+		})
+	}
+	svc.SetName("central")
+	markManaged("Service", &svc)
+	err = createService(ctx, client, &svc)
+	if err != nil {
+		return err
+	}
+
+	exposure := cfg.Central.Exposure
+	if exposure.LoadBalancer != nil && exposure.NodePort != nil {
+		return fmt.Errorf("central exposure: loadBalancer and nodePort are mutually exclusive")
+	}
+
+	external := v1.Service{
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{
+				"app": "central",
+			},
+			Ports: []v1.ServicePort{{
+				Name:       "https",
+				Port:       443,
+				TargetPort: intstr.FromString("api"),
+			}},
+		},
+	}
+	switch {
+	case exposure.LoadBalancer != nil:
+		lb := exposure.LoadBalancer
+		external.Spec.Type = v1.ServiceTypeLoadBalancer
+		external.Spec.LoadBalancerIP = lb.IP
+		// Copied, customizations are merged into the object's annotations
+		external.SetAnnotations(mergeMissing(nil, lb.Annotations))
+		if lb.Port != 0 {
+			external.Spec.Ports[0].Port = lb.Port
+		}
+	case exposure.NodePort != nil:
+		external.Spec.Type = v1.ServiceTypeNodePort
+		external.Spec.Ports[0].NodePort = exposure.NodePort.Port
+	default:
+		return nil
+	}
+	external.SetName("central-loadbalancer")
+	markManaged("Service", &external)
+
+	return createService(ctx, client, &external)
+}
+
+// createService creates svc, or updates it in place if it already exists.
+// Services are updated rather than left alone so that exposure changes are
+// picked up on re-runs.
+func createService(ctx context.Context, client *kubernetes.Clientset, svc *v1.Service) error {
+	serviceNetworking.Apply(svc)
+
+	// A service can't be switched between headless and not in place, so it
+	// is recreated
+	existing, err := client.CoreV1().Services(namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && headless(existing) != headless(svc) {
+		log("  recreating Service %s to change whether it is headless", svc.Name)
+		err = client.CoreV1().Services(namespace).Delete(ctx, svc.Name, deleteOptions())
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if dryRun {
+			journalObject("Service", svc)
+			reportWrite("create", "Service", svc)
+			return nil
+		}
+	}
+
+	return createOrUpdate(ctx, client.CoreV1().Services(namespace), "Service", svc, func(existing, svc *v1.Service) {
+		// ClusterIPs are immutable and allocated by the API server
+		if headless(existing) == headless(svc) {
+			svc.Spec.ClusterIP = existing.Spec.ClusterIP
+			svc.Spec.ClusterIPs = existing.Spec.ClusterIPs
+		}
+		// The families the cluster picked stay unless the config asks for
+		// others; a single-stack service can only be upgraded to dual-stack
+		if svc.Spec.IPFamilyPolicy == nil {
+			svc.Spec.IPFamilyPolicy = existing.Spec.IPFamilyPolicy
+		}
+		if len(svc.Spec.IPFamilies) == 0 {
+			svc.Spec.IPFamilies = existing.Spec.IPFamilies
+		}
+	})
+}
+
+func headless(svc *v1.Service) bool {
+	return svc.Spec.ClusterIP == v1.ClusterIPNone
+}
+
+func createCentralIngress(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	conf := cfg.Central.Exposure.Ingress
+	pathType := networking.PathTypePrefix
+	ingress := networking.Ingress{
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{{
+				Host: conf.Host,
+				IngressRuleValue: networking.IngressRuleValue{
+					HTTP: &networking.HTTPIngressRuleValue{
+						Paths: []networking.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networking.IngressBackend{
+								Service: &networking.IngressServiceBackend{
+									Name: "central",
+									Port: networking.ServiceBackendPort{
+										Name: "https",
+									},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if conf.ClassName != "" {
+		ingress.Spec.IngressClassName = &conf.ClassName
+	}
+	if conf.TLSSecret != "" {
+		ingress.Spec.TLS = []networking.IngressTLS{{
+			Hosts:      []string{conf.Host},
+			SecretName: conf.TLSSecret,
+		}}
+	}
+	// Central only serves TLS, which ingress-nginx has to be told about
+	ingress.SetAnnotations(mergeMissing(mergeMissing(nil, conf.Annotations), map[string]string{
+		"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+	}))
+	ingress.SetName("central")
+	markManaged("Ingress", &ingress)
+
+	return createOrUpdate(ctx, client.NetworkingV1().Ingresses(namespace), "Ingress", &ingress)
+}
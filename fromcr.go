@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// centralCR is the part of the StackRox operator's Central custom resource
+// (platform.stackrox.io/v1alpha1) that maps onto the installer config.
+type centralCR struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Central struct {
+			Exposure struct {
+				LoadBalancer *struct {
+					Enabled *bool  `json:"enabled"`
+					Port    int32  `json:"port"`
+					IP      string `json:"ip"`
+				} `json:"loadBalancer"`
+				NodePort *struct {
+					Enabled *bool `json:"enabled"`
+					Port    int32 `json:"port"`
+				} `json:"nodePort"`
+				Route *struct {
+					Enabled *bool  `json:"enabled"`
+					Host    string `json:"host"`
+				} `json:"route"`
+			} `json:"exposure"`
+			Resources    *v1.ResourceRequirements `json:"resources"`
+			NodeSelector map[string]string        `json:"nodeSelector"`
+			Tolerations  []v1.Toleration          `json:"tolerations"`
+			Telemetry    *struct {
+				Enabled *bool `json:"enabled"`
+			} `json:"telemetry"`
+			DB *struct {
+				NodeSelector map[string]string `json:"nodeSelector"`
+				Tolerations  []v1.Toleration   `json:"tolerations"`
+			} `json:"db"`
+		} `json:"central"`
+		ImagePullSecrets []struct {
+			Name string `json:"name"`
+		} `json:"imagePullSecrets"`
+		Customize *struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"customize"`
+		Monitoring *struct {
+			OpenShift *struct {
+				Enabled *bool `json:"enabled"`
+			} `json:"openshift"`
+		} `json:"monitoring"`
+		TLS *struct {
+			AdditionalCAs []struct {
+				Name    string `json:"name"`
+				Content string `json:"content"`
+			} `json:"additionalCAs"`
+		} `json:"tls"`
+		Network *struct {
+			Policies string `json:"policies"`
+		} `json:"network"`
+		Egress *struct {
+			ConnectivityPolicy string `json:"connectivityPolicy"`
+		} `json:"egress"`
+	} `json:"spec"`
+}
+
+// supportedCRFields lists, per section, the CR fields readCentralCR maps.
+// Anything else is reported so users know it was not carried over.
+var supportedCRFields = map[string][]string{
+	"spec":         {"central", "imagePullSecrets", "customize", "monitoring", "tls", "network", "egress"},
+	"spec.central": {"exposure", "resources", "nodeSelector", "tolerations", "telemetry", "db"},
+}
+
+func enabled(b *bool) bool {
+	return b != nil && *b
+}
+
+// readCentralCR builds the installer config from a Central custom resource,
+// for `-from-cr`.
+func readCentralCR(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cr centralCR
+	err = yaml.Unmarshal(data, &cr)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Kind != "Central" {
+		return nil, fmt.Errorf("%s: expected a Central resource, got kind %q", path, cr.Kind)
+	}
+
+	var raw map[string]interface{}
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	warnUnsupportedCRFields(raw)
+
+	cfg := &Config{Namespace: cr.Metadata.Namespace}
+	spec := cr.Spec
+	central := spec.Central
+
+	exposure := central.Exposure
+	if exposure.LoadBalancer != nil && enabled(exposure.LoadBalancer.Enabled) {
+		cfg.Central.Exposure.LoadBalancer = &LoadBalancerExposure{
+			Port: exposure.LoadBalancer.Port,
+			IP:   exposure.LoadBalancer.IP,
+		}
+	}
+	if exposure.NodePort != nil && enabled(exposure.NodePort.Enabled) {
+		cfg.Central.Exposure.NodePort = &NodePortExposure{Port: exposure.NodePort.Port}
+	}
+	if exposure.Route != nil && enabled(exposure.Route.Enabled) {
+		cfg.Central.Exposure.Route = &RouteExposure{Host: exposure.Route.Host}
+	}
+
+	cfg.Central.Performance.Resources = central.Resources
+	cfg.Central.Placement.NodeSelector = central.NodeSelector
+	cfg.Central.Placement.Tolerations = central.Tolerations
+	if central.Telemetry != nil {
+		cfg.Central.Telemetry.Enabled = central.Telemetry.Enabled
+	}
+	if central.DB != nil {
+		cfg.CentralDB.Placement.NodeSelector = central.DB.NodeSelector
+		cfg.CentralDB.Placement.Tolerations = central.DB.Tolerations
+	}
+
+	for _, s := range spec.ImagePullSecrets {
+		cfg.ImagePullSecrets.UseExisting = append(cfg.ImagePullSecrets.UseExisting, s.Name)
+	}
+	if spec.Customize != nil {
+		cfg.Customize.Labels = spec.Customize.Labels
+		cfg.Customize.Annotations = spec.Customize.Annotations
+	}
+	if spec.Monitoring != nil && spec.Monitoring.OpenShift != nil && enabled(spec.Monitoring.OpenShift.Enabled) {
+		cfg.Monitoring.OpenShift = true
+	}
+	if spec.TLS != nil {
+		for _, ca := range spec.TLS.AdditionalCAs {
+			cfg.AdditionalCAs = append(cfg.AdditionalCAs, AdditionalCA{Name: ca.Name, PEM: ca.Content})
+		}
+	}
+	if spec.Egress != nil && spec.Egress.ConnectivityPolicy == "Offline" {
+		cfg.OfflineMode = true
+	}
+	// The operator enables network policies unless told otherwise
+	cfg.NetworkPolicies.Enabled = spec.Network == nil || spec.Network.Policies != "Disabled"
+
+	return cfg, nil
+}
+
+func warnUnsupportedCRFields(raw map[string]interface{}) {
+	spec, _ := raw["spec"].(map[string]interface{})
+	central, _ := spec["central"].(map[string]interface{})
+	for section, fields := range map[string]map[string]interface{}{"spec": spec, "spec.central": central} {
+		supported := map[string]bool{}
+		for _, f := range supportedCRFields[section] {
+			supported[f] = true
+		}
+		var ignored []string
+		for f := range fields {
+			if !supported[f] {
+				ignored = append(ignored, f)
+			}
+		}
+		sort.Strings(ignored)
+		for _, f := range ignored {
+			log("Warning: %s.%s is not supported by the installer and is ignored", section, f)
+		}
+	}
+}
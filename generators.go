@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// generators lists every generator that can be selected with -only and
+// -skip: the steps of the apply stages, named after their description, and
+// what apply does outside of the stages.
+var generators = []string{
+	"namespace",
+	"priority-class",
+	"db-pvc-adoption",
+	"db-pvc",
+	"admin-password",
+	"central-db-password",
+	"tls-certificates",
+	"central-db-config",
+	"central-endpoints-config",
+	"central-config",
+	"image-pull-secret",
+	"additional-ca-secret",
+	"license-secret",
+	"declarative-configuration",
+	"central-db-deployment",
+	"central-db-connection-pooler",
+	"central-deployment",
+	"central-services",
+	"central-ingress",
+	"central-routes",
+	"central-disruption-budget",
+	"central-monitoring",
+	"network-policies",
+	"external-backups",
+	"api-token",
+	"post-install-hooks",
+}
+
+// GeneratorFilter selects the generators apply runs. Only, when set, runs
+// just the listed generators; Skip leaves out the listed ones. The -only and
+// -skip flags replace the respective list.
+type GeneratorFilter struct {
+	Only []string `json:"only,omitempty"`
+	Skip []string `json:"skip,omitempty"`
+}
+
+// onlyGenerators and skipGenerators are set by -only and -skip.
+var onlyGenerators, skipGenerators string
+
+// generatorFilter is resolved from the config and flags at the start of
+// apply.
+var generatorFilter generatorSelection
+
+type generatorSelection struct {
+	only map[string]bool
+	skip map[string]bool
+}
+
+// setGeneratorFilter resolves the generators to run from the config and the
+// -only and -skip flags.
+func setGeneratorFilter(cfg *Config) error {
+	only, skip := cfg.Generators.Only, cfg.Generators.Skip
+	if onlyGenerators != "" {
+		only = splitGeneratorList(onlyGenerators)
+	}
+	if skipGenerators != "" {
+		skip = splitGeneratorList(skipGenerators)
+	}
+
+	var err error
+	generatorFilter, err = newGeneratorSelection(only, skip)
+	return err
+}
+
+// splitGeneratorList splits the comma separated value of -only or -skip,
+// ignoring spaces and empty entries.
+func splitGeneratorList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newGeneratorSelection checks that only and skip name known generators, so
+// a typo is an error rather than a filter that matches nothing.
+func newGeneratorSelection(only, skip []string) (generatorSelection, error) {
+	toSet := func(names []string) (map[string]bool, error) {
+		set := map[string]bool{}
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if !isGenerator(name) {
+				return nil, fmt.Errorf("unknown generator %q, expected one of: %s", name, strings.Join(generators, ", "))
+			}
+			set[name] = true
+		}
+		return set, nil
+	}
+
+	var sel generatorSelection
+	var err error
+	sel.only, err = toSet(only)
+	if err != nil {
+		return sel, err
+	}
+	sel.skip, err = toSet(skip)
+
+	return sel, err
+}
+
+func isGenerator(name string) bool {
+	for _, g := range generators {
+		if g == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabled reports whether the named generator runs.
+func (s generatorSelection) enabled(name string) bool {
+	if len(s.only) > 0 && !s.only[name] {
+		return false
+	}
+	return !s.skip[name]
+}
+
+// generatorEnabled reports whether the named generator runs.
+func generatorEnabled(name string) bool {
+	return generatorFilter.enabled(name)
+}
+
+// generatorsFiltered reports whether -only or -skip leave anything out, in
+// which case prune would take the left out objects for orphans.
+func generatorsFiltered() bool {
+	return len(generatorFilter.only) > 0 || len(generatorFilter.skip) > 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitGeneratorList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"namespace", []string{"namespace"}},
+		{"namespace,central-deployment", []string{"namespace", "central-deployment"}},
+		{" namespace , central-deployment ", []string{"namespace", "central-deployment"}},
+		{"namespace,,central-deployment,", []string{"namespace", "central-deployment"}},
+	}
+	for _, tt := range tests {
+		got := splitGeneratorList(tt.in)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitGeneratorList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratorSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		only     []string
+		skip     []string
+		enabled  []string
+		disabled []string
+		wantErr  bool
+	}{
+		{
+			name:    "no filter runs everything",
+			enabled: generators,
+		},
+		{
+			name:     "only",
+			only:     []string{"central-deployment", "central-services"},
+			enabled:  []string{"central-deployment", "central-services"},
+			disabled: []string{"namespace", "central-db-deployment"},
+		},
+		{
+			name:     "skip",
+			skip:     []string{"namespace"},
+			enabled:  []string{"central-deployment", "priority-class"},
+			disabled: []string{"namespace"},
+		},
+		{
+			name:     "skip wins over only",
+			only:     []string{"central-deployment", "central-services"},
+			skip:     []string{"central-services"},
+			enabled:  []string{"central-deployment"},
+			disabled: []string{"central-services", "namespace"},
+		},
+		{
+			name:    "unknown only",
+			only:    []string{"central-deploymnet"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown skip",
+			skip:    []string{"foundation"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := newGeneratorSelection(tt.only, tt.skip)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for an unknown generator")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.enabled {
+				if !sel.enabled(name) {
+					t.Errorf("%s is disabled", name)
+				}
+			}
+			for _, name := range tt.disabled {
+				if sel.enabled(name) {
+					t.Errorf("%s is enabled", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStageUnknownStep(t *testing.T) {
+	ran := false
+	err := runStage("central", []step{{"central deploymnet", func() error {
+		ran = true
+		return nil
+	}}})
+	if err == nil {
+		t.Fatal("expected an error for a step that is not a known generator")
+	}
+	if ran {
+		t.Error("the unknown step ran")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// applyHAPreset fills in the settings that make Central more resilient.
+// Central has no leader election and isn't safe to run as several active
+// replicas against one database, so the preset keeps it at one replica. On
+// its own it only changes a scheduling preference, keeping Central off
+// central-db's node; only replicas set explicitly above one are spread out
+// and get a disruption budget. Anything set explicitly in the config is kept
+// as is.
+func (c *Config) applyHAPreset() {
+	if c.ComponentAntiAffinity == AntiAffinityNone {
+		c.ComponentAntiAffinity = AntiAffinityPreferred
+	}
+	if c.Central.Replicas == nil || *c.Central.Replicas < 2 {
+		log("Warning: the HA preset keeps Central at a single replica without a disruption budget and only prefers it on another node than central-db; set central.replicas above 1 for more")
+		return
+	}
+
+	// Keep replicas on different nodes when the scheduler can manage it
+	if c.Central.Placement.Affinity == nil {
+		c.Central.Placement.Affinity = &v1.Affinity{
+			PodAntiAffinity: &v1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{
+					Weight: 100,
+					PodAffinityTerm: v1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"app": "central",
+							},
+						},
+						TopologyKey: "kubernetes.io/hostname",
+					},
+				}},
+			},
+		}
+	}
+
+	// Spread replicas over zones, where the cluster has them
+	if c.Central.Placement.TopologySpreadConstraints == nil {
+		c.Central.Placement.TopologySpreadConstraints = []v1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       "topology.kubernetes.io/zone",
+			WhenUnsatisfiable: v1.ScheduleAnyway,
+		}}
+	}
+
+	// A budget for a single replica would only block node drains
+	if c.Central.DisruptionBudget == nil {
+		minAvailable := intstr.FromInt(1)
+		c.Central.DisruptionBudget = &DisruptionBudget{MinAvailable: &minAvailable}
+	}
+}
+
+// warnCentralReplicas warns about running more than one Central, which is
+// left to an explicit central.replicas.
+func (c *Config) warnCentralReplicas() {
+	if c.Central.Replicas != nil && *c.Central.Replicas > 1 {
+		log("Warning: central.replicas is %d, but Central has no leader election and its replicas all act on the same database", *c.Central.Replicas)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Hooks are Jobs run at fixed points of apply.
+type Hooks struct {
+	// PostInstall runs once Central is ready, in order, each waiting for the
+	// one before it. Use them for work that needs a running Central, such as
+	// bootstrapping it through its API.
+	PostInstall []Hook `json:"postInstall,omitempty"`
+	// PodSecurity applies to every hook pod.
+	PodSecurity PodSecurity `json:"podSecurity,omitempty"`
+	// TTLAfterFinished is how long finished hook Jobs and their pods are
+	// kept before Kubernetes deletes them. Defaults to 1h, leaving time to
+	// look at a failed hook. It can't be less than a minute, so apply sees
+	// the Job finish before it is gone.
+	TTLAfterFinished *metav1.Duration `json:"ttlAfterFinished,omitempty"`
+}
+
+// Hook is a Job. Its container gets ROX_ENDPOINT pointing at Central,
+// ROX_CA_CERT_FILE for Central's CA and, unless admin auth is disabled,
+// ROX_ADMIN_PASSWORD, which is what roxctl reads.
+type Hook struct {
+	Name string `json:"name"`
+	// Image defaults to the main image, which has roxctl.
+	Image   string      `json:"image,omitempty"`
+	Command []string    `json:"command,omitempty"`
+	Args    []string    `json:"args,omitempty"`
+	Env     []v1.EnvVar `json:"env,omitempty"`
+	// BackoffLimit is the number of retries. Defaults to 2.
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// Timeout defaults to 10m.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+const (
+	hookCAPath = "/run/secrets/stackrox.io/ca"
+	// hookLogLines is how much of a failed hook's log is shown.
+	hookLogLines = int64(50)
+
+	defaultHookTTL = time.Hour
+	minHookTTL     = time.Minute
+)
+
+func (h Hooks) ttlSeconds() *int32 {
+	ttl := defaultHookTTL
+	if h.TTLAfterFinished != nil {
+		ttl = h.TTLAfterFinished.Duration
+	}
+	seconds := int32(ttl.Seconds())
+	return &seconds
+}
+
+func (h Hook) jobName() string {
+	return "post-install-" + h.Name
+}
+
+// validate checks the hooks up front, as a name that can't name a Job would
+// otherwise only fail after the rest of apply changed the cluster.
+// The Job name goes into the job-name label of its pods, so it has to be a
+// DNS label rather than just a subdomain.
+func (h Hooks) validate() error {
+	if h.TTLAfterFinished != nil && h.TTLAfterFinished.Duration < minHookTTL {
+		return fmt.Errorf("hooks.ttlAfterFinished must be at least %s", minHookTTL)
+	}
+	seen := map[string]bool{}
+	for _, hook := range h.PostInstall {
+		if hook.Name == "" {
+			return fmt.Errorf("hooks.postInstall: every hook needs a name")
+		}
+		if errs := validation.IsDNS1123Label(hook.jobName()); len(errs) > 0 {
+			return fmt.Errorf("hooks.postInstall: name %q gives the invalid Job name %s: %s", hook.Name, hook.jobName(), strings.Join(errs, ", "))
+		}
+		if seen[hook.Name] {
+			return fmt.Errorf("hooks.postInstall: name %q is used more than once", hook.Name)
+		}
+		seen[hook.Name] = true
+	}
+
+	return nil
+}
+
+// runPostInstallHooks runs every post-install hook to completion.
+func runPostInstallHooks(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	for _, h := range cfg.Hooks.PostInstall {
+		log("  %s", h.Name)
+		err := runHook(ctx, client, cfg, h)
+		if err != nil {
+			return fmt.Errorf("post-install hook %s: %w", h.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func runHook(ctx context.Context, client *kubernetes.Clientset, cfg *Config, h Hook) error {
+	image := h.Image
+	if image == "" {
+		image = cfg.mainImage()
+	}
+	backoffLimit := int32(2)
+	if h.BackoffLimit != nil {
+		backoffLimit = *h.BackoffLimit
+	}
+	timeout := 10 * time.Minute
+	if h.Timeout != nil {
+		timeout = h.Timeout.Duration
+	}
+
+	env := []v1.EnvVar{
+		{Name: "ROX_ENDPOINT", Value: fmt.Sprintf("central.%s.svc:443", namespace)},
+		{Name: "ROX_CA_CERT_FILE", Value: hookCAPath + "/ca.pem"},
+	}
+	if !cfg.Central.AdminAuth.Disabled {
+		env = append(env, v1.EnvVar{
+			Name: "ROX_ADMIN_PASSWORD",
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: "admin-pass"},
+					Key:                  "password",
+				},
+			},
+		})
+	}
+
+	automount := false
+	job := batch.Job{
+		Spec: batch.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: cfg.Hooks.ttlSeconds(),
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						managedByLabel: managedByValue,
+						partOfLabel:    partOfValue,
+					},
+				},
+				Spec: v1.PodSpec{
+					RestartPolicy:                v1.RestartPolicyNever,
+					AutomountServiceAccountToken: &automount,
+					Containers: []v1.Container{{
+						Name:    "hook",
+						Image:   image,
+						Command: h.Command,
+						Args:    h.Args,
+						Env:     append(env, h.Env...),
+						VolumeMounts: []v1.VolumeMount{{
+							Name:      "central-ca",
+							MountPath: hookCAPath,
+							ReadOnly:  true,
+						}},
+					}},
+					Volumes: []v1.Volume{{
+						Name: "central-ca",
+						VolumeSource: v1.VolumeSource{
+							Secret: &v1.SecretVolumeSource{
+								SecretName: "central-tls",
+								Items:      []v1.KeyToPath{{Key: "ca.pem", Path: "ca.pem"}},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+	err := cfg.Hooks.PodSecurity.Apply(&job.Spec.Template)
+	if err != nil {
+		return err
+	}
+	cfg.applyPriorityClass(&job.Spec.Template.Spec, ComponentConfig{})
+	cfg.applyPullPolicy(&job.Spec.Template.Spec)
+	cfg.applyPullSecrets(&job.Spec.Template.Spec)
+	job.SetName(h.jobName())
+	markManaged("Job", &job)
+
+	// A Job's template is immutable, so the one from the previous run is
+	// replaced rather than updated
+	jobs := client.BatchV1().Jobs(namespace)
+	propagation := metav1.DeletePropagationForeground
+	opts := deleteOptions()
+	opts.PropagationPolicy = &propagation
+	err = jobs.Delete(ctx, job.Name, opts)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && dryRun {
+		// The dry run delete leaves the job in place, so a create would
+		// only fail on it
+		journalObject("Job", &job)
+		log("  would replace Job/%s", job.Name)
+		return nil
+	}
+	if err == nil {
+		err = wait.PollUntilContextTimeout(ctx, 2*time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+			_, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		})
+		if err != nil {
+			return fmt.Errorf("waiting for the previous job %s to be deleted: %w", job.Name, err)
+		}
+	}
+
+	journalObject("Job", &job)
+	err = retryTransient("Job", &job, func() error {
+		_, err := jobs.Create(ctx, &job, createOptions())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	reportWrite("create", "Job", &job)
+	if dryRun {
+		return nil
+	}
+
+	return waitForJob(ctx, client, job.Name, timeout)
+}
+
+// waitForJob blocks until the named job succeeds. When it fails, the end of
+// its pods' logs is part of the error.
+func waitForJob(ctx context.Context, client *kubernetes.Clientset, name string, timeout time.Duration) error {
+	var failure string
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		job, err := client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Status != v1.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batch.JobComplete:
+				return true, nil
+			case batch.JobFailed:
+				failure = c.Message
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == nil && failure == "" {
+		return nil
+	}
+	if err != nil {
+		failure = err.Error()
+	}
+
+	return fmt.Errorf("job %s did not complete: %s%s", name, failure, jobLogs(ctx, client, name))
+}
+
+// jobLogs returns the last lines of every pod the job ran, for error
+// messages.
+func jobLogs(ctx context.Context, client *kubernetes.Clientset, name string) string {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	lines := hookLogLines
+	for _, pod := range pods.Items {
+		stream, err := client.CoreV1().Pods(namespace).GetLogs(pod.Name, &v1.PodLogOptions{TailLines: &lines}).Stream(ctx)
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, stream)
+		stream.Close()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "\n--- %s ---\n%s", pod.Name, strings.TrimRight(buf.String(), "\n"))
+	}
+
+	return b.String()
+}
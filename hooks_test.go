@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHooksValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   []string
+		wantErr bool
+	}{
+		{"valid", []string{"create-token", "seed-policies"}, false},
+		{"none", nil, false},
+		{"empty", []string{""}, true},
+		{"upper case", []string{"CreateToken"}, true},
+		{"underscore", []string{"create_token"}, true},
+		{"dot", []string{"create.token"}, true},
+		{"trailing dash", []string{"create-"}, true},
+		{"too long with the prefix", []string{strings.Repeat("a", 63-len("post-install-")+1)}, true},
+		{"longest", []string{strings.Repeat("a", 63-len("post-install-"))}, false},
+		{"duplicate", []string{"a", "a"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hooks Hooks
+			for _, name := range tt.hooks {
+				hooks.PostInstall = append(hooks.PostInstall, Hook{Name: name})
+			}
+			err := hooks.validate()
+			if tt.wantErr && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
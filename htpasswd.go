@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AdminAuth configures Central's basic auth for the admin user.
+type AdminAuth struct {
+	// Password is stored in admin-pass instead of a generated one.
+	Password string `json:"password,omitempty"`
+	// Disabled leaves out admin-pass and central-htpasswd, so Central has no
+	// basic auth provider and users sign in through an auth provider only.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// createAdminPassword creates admin-pass and the central-htpasswd secret
+// Central reads the admin's bcrypt hash from.
+func createAdminPassword(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	// A configured password replaces whatever is stored, a generated one is
+	// only created once
+	if cfg.Central.AdminAuth.Password != "" {
+		secret := v1.Secret{
+			StringData: map[string]string{
+				"password": cfg.Central.AdminAuth.Password,
+			},
+		}
+		secret.SetName("admin-pass")
+		markManaged("Secret", &secret)
+		err := secretBackend.write(ctx, &secret, false)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := createPasswordSecret(ctx, client, cfg, "admin-pass")
+		if err != nil {
+			return err
+		}
+	}
+
+	password, err := adminPassword(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	// bcrypt salts every hash, so keep the existing one while it matches to
+	// avoid rewriting the secret on every run
+	var htpasswd string
+	existing, err := secretBackend.read(ctx, "central-htpasswd")
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		user, hash, _ := strings.Cut(strings.TrimSpace(string(existing.Data["htpasswd"])), ":")
+		if user == "admin" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			htpasswd = string(existing.Data["htpasswd"])
+		}
+	}
+	if htpasswd == "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		htpasswd = fmt.Sprintf("admin:%s\n", hash)
+	}
+
+	secret := v1.Secret{
+		StringData: map[string]string{
+			"htpasswd": htpasswd,
+		},
+	}
+	secret.SetName("central-htpasswd")
+	markManaged("Secret", &secret)
+	return secretBackend.write(ctx, &secret, false)
+}
+
+// adminPassword reads back the password in admin-pass, which may predate this
+// run.
+func adminPassword(ctx context.Context, cfg *Config) (string, error) {
+	if cfg.Central.AdminAuth.Password != "" {
+		return cfg.Central.AdminAuth.Password, nil
+	}
+
+	secret, err := secretBackend.read(ctx, "admin-pass")
+	// A dry run didn't persist the secret it would have created
+	if dryRun && errors.IsNotFound(err) {
+		return generatePassword(cfg, "admin-pass")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret.Data["password"]), nil
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ociDescriptor is the subset of an OCI content descriptor the bundle needs.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest covers both image manifests and image indexes/manifest lists.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    *ociDescriptor  `json:"config,omitempty"`
+	Layers    []ociDescriptor `json:"layers,omitempty"`
+	Manifests []ociDescriptor `json:"manifests,omitempty"`
+}
+
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// imagesCommand implements `installer images export|push`.
+func imagesCommand(ctx context.Context, cfg *Config, confPaths []string, lockPath string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: images export --output <bundle.tar> | images push --bundle <bundle.tar> --registry <mirror>")
+	}
+
+	fs := flag.NewFlagSet("images", flag.ExitOnError)
+	output := fs.String("output", "bundle.tar", "bundle file to write")
+	bundle := fs.String("bundle", "bundle.tar", "bundle file to push")
+	mirror := fs.String("registry", "", "registry to push the bundled images to")
+	username := fs.String("username", "", "username for the target registry, defaults to the pull secret credentials when they are for it")
+	password := fs.String("password", "", "password for the target registry")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "export":
+		return exportImages(ctx, cfg, *output)
+	case "push":
+		if *mirror == "" {
+			return errors.New("images push requires --registry")
+		}
+		if *username == "" {
+			host, _ := splitRegistry(strings.TrimSuffix(*mirror, "/") + "/")
+			*username, *password = cfg.registryCredentials(host)
+		}
+		err := pushImages(ctx, *bundle, *mirror, *username, *password)
+		if err != nil {
+			return err
+		}
+		if cfg.lock != nil {
+			err = cfg.lock.relock(lockPath, *mirror)
+			if err != nil {
+				return err
+			}
+		}
+		if len(confPaths) == 0 {
+			log("Set registry: %s in your config to install from the mirror", *mirror)
+			return nil
+		}
+		// The last file overrides the others, so the mirror sticks
+		return setConfigRegistry(confPaths[len(confPaths)-1], *mirror)
+	}
+
+	return fmt.Errorf("unknown images action %q", args[0])
+}
+
+// exportImages pulls every configured image, including all platforms of
+// multi-arch images, into an OCI image layout stored in a tarball.
+func exportImages(ctx context.Context, cfg *Config, output string) error {
+	dir, err := os.MkdirTemp("", "stackrox-images")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	if err != nil {
+		return err
+	}
+
+	refs := cfg.imageRefs()
+	components := make([]string, 0, len(refs))
+	for component := range refs {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	index := ociIndex{SchemaVersion: 2, MediaType: "application/vnd.oci.image.index.v1+json"}
+	for _, component := range components {
+		image := cfg.pinnedImage(component)
+		ref := image
+		if cfg.lock != nil {
+			ref = cfg.lock.Images[component].Tagged()
+		}
+		log("Pulling %s", image)
+		name, tag, digest := splitImage(image)
+		reference := digest
+		if reference == "" {
+			reference = tag
+		}
+		if reference == "" {
+			reference = "latest"
+		}
+
+		repo := cfg.registryRepo(name)
+		desc, err := pullManifest(ctx, repo, reference, dir)
+		if err != nil {
+			return fmt.Errorf("pulling %s: %w", image, err)
+		}
+		desc.Annotations = map[string]string{ociRefNameAnnotation: ref}
+		index.Manifests = append(index.Manifests, desc)
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, "index.json"), data, 0644)
+	if err != nil {
+		return err
+	}
+
+	log("Writing %s", output)
+	return tarDirectory(dir, output)
+}
+
+// pullManifest stores a manifest and everything it references in the layout
+// at dir and returns its descriptor.
+func pullManifest(ctx context.Context, repo *registryRepo, reference, dir string) (ociDescriptor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, repo.url("manifests/%s", reference), nil)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	resp, err := repo.do(req)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ociDescriptor{}, fmt.Errorf("fetching manifest %s: registry returned %s", reference, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	var manifest ociManifest
+	err = json.Unmarshal(body, &manifest)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+	}
+
+	desc := ociDescriptor{
+		MediaType: manifest.MediaType,
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(body)),
+		Size:      int64(len(body)),
+	}
+	err = os.WriteFile(blobPath(dir, desc.Digest), body, 0644)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	for _, child := range manifest.Manifests {
+		_, err = pullManifest(ctx, repo, child.Digest, dir)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+	}
+	blobs := manifest.Layers
+	if manifest.Config != nil {
+		blobs = append(blobs, *manifest.Config)
+	}
+	for _, blob := range blobs {
+		err = pullBlob(ctx, repo, blob.Digest, dir)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+	}
+
+	return desc, nil
+}
+
+func pullBlob(ctx context.Context, repo *registryRepo, digest, dir string) error {
+	path := blobPath(dir, digest)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, repo.url("blobs/%s", digest), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := repo.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching blob %s: registry returned %s", digest, resp.Status)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if err != nil {
+		return err
+	}
+	if got := fmt.Sprintf("sha256:%x", hash.Sum(nil)); got != digest {
+		return fmt.Errorf("blob %s has digest %s", digest, got)
+	}
+
+	return nil
+}
+
+// pushImages pushes every image in a bundle written by exportImages to
+// mirror, keeping each image's repository path and tag.
+func pushImages(ctx context.Context, bundle, mirror, username, password string) error {
+	dir, err := os.MkdirTemp("", "stackrox-images")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = untarFile(bundle, dir)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return err
+	}
+	var index ociIndex
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		return err
+	}
+
+	mirrorCfg := &Config{Registry: mirror}
+	for _, desc := range index.Manifests {
+		source := desc.Annotations[ociRefNameAnnotation]
+		target := mirrorCfg.resolveImage(source, "")
+		log("Pushing %s", target)
+
+		// Locked images are bundled as name:tag@digest, which resolves to
+		// the digest alone, and are pushed under their tag
+		name, _, _ := splitImage(target)
+		_, tag, _ := splitImage(source)
+		reference := tag
+		if reference == "" {
+			reference = desc.Digest
+		}
+		repo := newRegistryRepo(name, username, password)
+		err = pushManifest(ctx, repo, desc, reference, dir)
+		if err != nil {
+			return fmt.Errorf("pushing %s: %w", target, err)
+		}
+	}
+
+	return nil
+}
+
+func pushManifest(ctx context.Context, repo *registryRepo, desc ociDescriptor, reference, dir string) error {
+	body, err := os.ReadFile(blobPath(dir, desc.Digest))
+	if err != nil {
+		return err
+	}
+	var manifest ociManifest
+	err = json.Unmarshal(body, &manifest)
+	if err != nil {
+		return err
+	}
+
+	// Children and blobs have to exist before the manifest referencing them
+	for _, child := range manifest.Manifests {
+		err = pushManifest(ctx, repo, child, child.Digest, dir)
+		if err != nil {
+			return err
+		}
+	}
+	blobs := manifest.Layers
+	if manifest.Config != nil {
+		blobs = append(blobs, *manifest.Config)
+	}
+	for _, blob := range blobs {
+		err = pushBlob(ctx, repo, blob.Digest, dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, repo.url("manifests/%s", reference), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", desc.MediaType)
+	resp, err := repo.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("pushing manifest %s: registry returned %s", reference, resp.Status)
+	}
+
+	return nil
+}
+
+func pushBlob(ctx context.Context, repo *registryRepo, digest, dir string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, repo.url("blobs/%s", digest), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := repo.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, repo.url("blobs/uploads/"), http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err = repo.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("starting upload of %s: registry returned %s", digest, resp.Status)
+	}
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	path := blobPath(dir, digest)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, location.String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	resp, err = repo.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("uploading %s: registry returned %s", digest, resp.Status)
+	}
+
+	return nil
+}
+
+// topLevelRegistry matches the registry key of a config file.
+var topLevelRegistry = regexp.MustCompile(`(?m)^registry:.*$`)
+
+// setConfigRegistry points the config file at the mirror. Only the registry
+// line is touched, so comments, key order and the file mode stay as they
+// are. SOPS encrypted files would fail their MAC check afterwards and are
+// left for the user to edit.
+func setConfigRegistry(confPath, mirror string) error {
+	info, err := os.Stat(confPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return err
+	}
+	if isSOPSEncrypted(data) {
+		log("%s is SOPS encrypted, set registry: %s in it to install from the mirror", confPath, mirror)
+		return nil
+	}
+
+	line := "registry: " + strconv.Quote(mirror)
+	if topLevelRegistry.Match(data) {
+		data = topLevelRegistry.ReplaceAllLiteral(data, []byte(line))
+	} else {
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		data = append(data, line+"\n"...)
+	}
+	log("Setting registry to %s in %s", mirror, confPath)
+
+	return os.WriteFile(confPath, data, info.Mode().Perm())
+}
+
+func blobPath(dir, digest string) string {
+	return filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+func tarDirectory(dir, output string) error {
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		err = tw.WriteHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func untarFile(bundle, dir string) error {
+	f, err := os.Open(bundle)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("bundle entry %s escapes the bundle directory", header.Name)
+		}
+		if header.Typeflag == tar.TypeDir {
+			err = os.MkdirAll(path, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
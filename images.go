@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Images holds the image reference of every component. Registry and
+// ImageTagOverride in Config are applied on top of these.
+type Images struct {
+	Main      string `json:"main,omitempty"`
+	CentralDB string `json:"centralDb,omitempty"`
+	// PgBouncer is only used with centralDb.connectionPooling.
+	PgBouncer string `json:"pgbouncer,omitempty"`
+}
+
+const (
+	defaultMainImage      = "quay.io/stackrox-io/main:latest"
+	defaultCentralDBImage = "quay.io/stackrox-io/central-db:latest"
+	defaultPgBouncerImage = "docker.io/edoburu/pgbouncer:v1.22.1-p0"
+)
+
+func (c *Config) mainImage() string {
+	return c.pinnedImage("main")
+}
+
+func (c *Config) centralDBImage() string {
+	return c.pinnedImage("centralDb")
+}
+
+func (c *Config) pgBouncerImage() string {
+	return c.pinnedImage("pgbouncer")
+}
+
+// imageRefs returns every component's image after registry and tag overrides,
+// keyed by its name in Images.
+func (c *Config) imageRefs() map[string]string {
+	refs := map[string]string{
+		"main":      c.resolveImage(c.Images.Main, defaultMainImage),
+		"centralDb": c.resolveImage(c.Images.CentralDB, defaultCentralDBImage),
+	}
+	if c.CentralDB.ConnectionPooling != nil {
+		refs["pgbouncer"] = c.resolveImage(c.Images.PgBouncer, defaultPgBouncerImage)
+	}
+
+	return refs
+}
+
+// pinnedImage returns the image for component, pinned to its digest when a
+// lock file was loaded.
+func (c *Config) pinnedImage(component string) string {
+	if c.lock != nil {
+		return c.lock.Images[component].Pinned()
+	}
+
+	return c.imageRefs()[component]
+}
+
+// resolveImage applies the global registry and tag overrides to image, keeping
+// its repository path: with registry "mirror:5000",
+// quay.io/stackrox-io/main:latest becomes mirror:5000/stackrox-io/main:latest.
+func (c *Config) resolveImage(image, fallback string) string {
+	if image == "" {
+		image = fallback
+	}
+
+	name, tag, digest := splitImage(image)
+	if c.Registry != "" {
+		path := name
+		if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+			path = name[i+1:]
+		}
+		name = strings.TrimSuffix(c.Registry, "/") + "/" + path
+	}
+	if c.ImageTagOverride != "" {
+		tag = c.ImageTagOverride
+		digest = ""
+	}
+
+	switch {
+	case digest != "":
+		return name + "@" + digest
+	case tag != "":
+		return name + ":" + tag
+	}
+
+	return name
+}
+
+// applyPullPolicy sets the configured pull policy on every container in spec.
+func (c *Config) applyPullPolicy(spec *v1.PodSpec) {
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].ImagePullPolicy = c.ImagePullPolicy
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].ImagePullPolicy = c.ImagePullPolicy
+	}
+}
+
+// splitImage splits an image reference into name, tag and digest.
+func splitImage(image string) (name, tag, digest string) {
+	name = image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	// A colon after the last slash separates the tag; one before it is a port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+
+	return name, tag, digest
+}
+
+// isRegistryHost reports whether the first path component of an image name is
+// a registry host rather than a Docker Hub namespace.
+func isRegistryHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
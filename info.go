@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// configSchemaVersion is bumped whenever installer.yaml changes
+	// incompatibly.
+	configSchemaVersion = "v1"
+	// supportedStackRoxVersions is the StackRox range the generated manifests
+	// target; older releases have no central-db.
+	supportedStackRoxVersions = ">= 4.0"
+)
+
+// actions lists every top-level action, for usage and completion.
+var actions = []string{
+	"adopt",
+	"apply",
+	"backup",
+	"completion",
+	"dev",
+	"endpoints",
+	"env",
+	"export",
+	"images",
+	"list",
+	"lock",
+	"logs",
+	"port-forward",
+	"preflight",
+	"restore",
+	"rollback",
+	"schema",
+	"status",
+	"support-bundle",
+	"version",
+}
+
+// installerVersion returns the module version and VCS revision the installer
+// was built from.
+func installerVersion() (version, revision string) {
+	version, revision = "(devel)", "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				revision = s.Value
+			}
+		}
+	}
+
+	return version, revision
+}
+
+func printVersion() {
+	version, revision := installerVersion()
+
+	fmt.Printf("Version:            %s\n", version)
+	fmt.Printf("Revision:           %s\n", revision)
+	fmt.Printf("Go:                 %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Config schema:      %s\n", configSchemaVersion)
+	fmt.Printf("StackRox versions:  %s\n", supportedStackRoxVersions)
+}
+
+// printEnv shows how the installer resolves its environment, without
+// contacting the cluster.
+func printEnv(kubeconfig string, confPaths []string, cfg *Config) {
+	fmt.Printf("Kubeconfig:  %s\n", kubeconfig)
+
+	raw, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		fmt.Printf("Context:     (unavailable: %v)\n", err)
+	} else {
+		context := raw.CurrentContext
+		fmt.Printf("Context:     %s\n", context)
+		if c, ok := raw.Contexts[context]; ok {
+			if cluster, ok := raw.Clusters[c.Cluster]; ok {
+				fmt.Printf("Server:      %s\n", cluster.Server)
+			}
+			fmt.Printf("User:        %s\n", c.AuthInfo)
+		}
+	}
+
+	fmt.Printf("Namespace:   %s\n", namespace)
+	confPath := strings.Join(confPaths, ", ")
+	if confPath == "" {
+		confPath = "(none, using defaults)"
+	}
+	fmt.Printf("Config:      %s\n", confPath)
+	fmt.Printf("Registry:    %s\n", cfg.Registry)
+	refs := cfg.imageRefs()
+	components := make([]string, 0, len(refs))
+	for component := range refs {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		fmt.Printf("Image:       %s=%s\n", component, refs[component])
+	}
+}
+
+func printCompletion(args []string) error {
+	shell := "bash"
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	name := os.Args[0]
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	words := strings.Join(actions, " ")
+	switch shell {
+	case "bash":
+		fmt.Printf("complete -W %q %s\n", words, name)
+	case "zsh":
+		fmt.Printf("autoload -U +X bashcompinit && bashcompinit\ncomplete -W %q %s\n", words, name)
+	case "fish":
+		fmt.Printf("complete -c %s -f -n __fish_use_subcommand -a %q\n", name, words)
+	default:
+		return errors.New("completion supports bash, zsh and fish")
+	}
+
+	return nil
+}
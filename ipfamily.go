@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Networking selects the IP families of the generated Services, for
+// IPv6-only and dual-stack clusters. Unset fields leave the choice to the
+// cluster, which is single-stack on its primary family.
+type Networking struct {
+	IPFamilyPolicy *v1.IPFamilyPolicy `json:"ipFamilyPolicy,omitempty"`
+	// IPFamilies lists IPv4, IPv6 or both; the first one is the primary
+	// family.
+	IPFamilies []v1.IPFamily `json:"ipFamilies,omitempty"`
+}
+
+// serviceNetworking is set from the config at the start of apply and used by
+// createService.
+var serviceNetworking Networking
+
+func (n Networking) validate() error {
+	if len(n.IPFamilies) > 2 {
+		return fmt.Errorf("networking.ipFamilies may list at most two families")
+	}
+	seen := map[v1.IPFamily]bool{}
+	for _, family := range n.IPFamilies {
+		if family != v1.IPv4Protocol && family != v1.IPv6Protocol {
+			return fmt.Errorf("networking.ipFamilies: unknown family %q, expected %s or %s", family, v1.IPv4Protocol, v1.IPv6Protocol)
+		}
+		if seen[family] {
+			return fmt.Errorf("networking.ipFamilies lists %s twice", family)
+		}
+		seen[family] = true
+	}
+	if n.IPFamilyPolicy == nil {
+		return nil
+	}
+	switch *n.IPFamilyPolicy {
+	case v1.IPFamilyPolicySingleStack:
+		if len(n.IPFamilies) > 1 {
+			return fmt.Errorf("networking.ipFamilyPolicy %s allows a single family only", v1.IPFamilyPolicySingleStack)
+		}
+	case v1.IPFamilyPolicyPreferDualStack, v1.IPFamilyPolicyRequireDualStack:
+	default:
+		return fmt.Errorf("unknown networking.ipFamilyPolicy %q, expected %s, %s or %s", *n.IPFamilyPolicy, v1.IPFamilyPolicySingleStack, v1.IPFamilyPolicyPreferDualStack, v1.IPFamilyPolicyRequireDualStack)
+	}
+
+	return nil
+}
+
+// ipv6 reports whether Services may get IPv6 addresses.
+func (n Networking) ipv6() bool {
+	for _, family := range n.IPFamilies {
+		if family == v1.IPv6Protocol {
+			return true
+		}
+	}
+	return n.IPFamilyPolicy != nil && *n.IPFamilyPolicy != v1.IPFamilyPolicySingleStack
+}
+
+// Apply sets the IP families on svc.
+func (n Networking) Apply(svc *v1.Service) {
+	if n.IPFamilyPolicy != nil {
+		svc.Spec.IPFamilyPolicy = n.IPFamilyPolicy
+	}
+	if len(n.IPFamilies) > 0 {
+		svc.Spec.IPFamilies = n.IPFamilies
+	}
+}
+
+// listenAddress normalizes an endpoint's listen address. A bare port listens
+// on every address, and so does the IPv4 wildcard when Services may be IPv6,
+// since 0.0.0.0 would leave Central unreachable over IPv6.
+func (n Networking) listenAddress(listen string) (string, error) {
+	_, err := strconv.ParseUint(listen, 10, 16)
+	if err == nil {
+		return ":" + listen, nil
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("endpoint listen address %q: %w; IPv6 addresses need brackets, as in [::1]:8444", listen, err)
+	}
+	if host == "0.0.0.0" && n.ipv6() {
+		return ":" + port, nil
+	}
+
+	return listen, nil
+}
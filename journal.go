@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// Every successful apply is recorded in a journal secret holding the config
+// as written (before presets are applied), the image lock and a hash of each
+// object written. A secret rather than a ConfigMap since the config may hold
+// credentials. Journal secrets don't carry the managed-by label, so prune
+// leaves them alone.
+const (
+	journalLabel       = "stackrox.io/installer-journal"
+	journalPrefix      = "installer-journal-"
+	journalKeepEntries = 5
+)
+
+// appliedObjects maps "Kind/name" to the hash of every object written during
+// this run.
+var appliedObjects = map[string]string{}
+
+// appliedMu guards appliedObjects, which apply steps fill concurrently.
+var appliedMu sync.Mutex
+
+func journalObject(kind string, obj metav1.Object) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	appliedMu.Lock()
+	appliedObjects[kind+"/"+obj.GetName()] = hex.EncodeToString(sum[:])
+	appliedMu.Unlock()
+}
+
+// writeJournal records this run and drops the oldest entries beyond
+// journalKeepEntries.
+func writeJournal(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	objects, err := yaml.Marshal(appliedObjects)
+	if err != nil {
+		return err
+	}
+	data := map[string][]byte{
+		"config.yaml":  cfg.snapshot,
+		"objects.yaml": objects,
+	}
+	if cfg.lock != nil {
+		lock, err := yaml.Marshal(cfg.lock)
+		if err != nil {
+			return err
+		}
+		data["lock.yaml"] = lock
+	}
+
+	secret := v1.Secret{Data: data}
+	secret.SetName(journalPrefix + applyRevision)
+	secret.SetLabels(map[string]string{journalLabel: "true"})
+	secrets := client.CoreV1().Secrets(namespace)
+	_, err = secrets.Create(ctx, &secret, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	entries, err := journalEntries(ctx, client)
+	if err != nil {
+		return err
+	}
+	for len(entries) > journalKeepEntries {
+		err = secrets.Delete(ctx, entries[0].Name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		entries = entries[1:]
+	}
+
+	return nil
+}
+
+// journalEntries returns the journal, oldest first.
+func journalEntries(ctx context.Context, client *kubernetes.Clientset) ([]v1.Secret, error) {
+	list, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: journalLabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+	entries := list.Items
+	// Revisions are timestamps, so names sort chronologically
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+// rollback implements `installer rollback [revision]`. It re-applies the
+// config and image lock recorded for the given revision, by default the one
+// before the latest, and prunes whatever was added since.
+func rollback(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, args []string, waitTimeout time.Duration) error {
+	entries, err := journalEntries(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var entry *v1.Secret
+	if len(args) > 0 {
+		for i := range entries {
+			if strings.TrimPrefix(entries[i].Name, journalPrefix) == args[0] {
+				entry = &entries[i]
+			}
+		}
+		if entry == nil {
+			return fmt.Errorf("no journal entry for revision %s", args[0])
+		}
+	} else {
+		if len(entries) < 2 {
+			return fmt.Errorf("the journal has no revision before the current one")
+		}
+		entry = &entries[len(entries)-2]
+	}
+
+	cfg := &Config{}
+	err = yaml.UnmarshalStrict(entry.Data["config.yaml"], cfg)
+	if err != nil {
+		return fmt.Errorf("reading config of %s: %w", entry.Name, err)
+	}
+	// The revision is applied to the namespace it names, which may not be
+	// the current one
+	namespace = defaultNamespace
+	if cfg.Namespace != "" {
+		namespace = cfg.Namespace
+	}
+	err = cfg.complete()
+	if err != nil {
+		return err
+	}
+	if lock, ok := entry.Data["lock.yaml"]; ok {
+		cfg.lock = &LockFile{}
+		err = yaml.UnmarshalStrict(lock, cfg.lock)
+		if err != nil {
+			return fmt.Errorf("reading image lock of %s: %w", entry.Name, err)
+		}
+	}
+
+	log("Rolling back to revision %s", strings.TrimPrefix(entry.Name, journalPrefix))
+	apply(ctx, client, config, cfg, true, waitTimeout)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// License is the StackRox license key, given either inline or as a path to
+// the license file.
+type License struct {
+	Key  string `json:"key,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+func (l License) load() ([]byte, error) {
+	if (l.Key == "") == (l.File == "") {
+		return nil, fmt.Errorf("license: exactly one of key and file must be set")
+	}
+
+	data := []byte(l.Key)
+	if l.File != "" {
+		var err error
+		data, err = os.ReadFile(l.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, fmt.Errorf("license: the license key is empty")
+	}
+
+	return data, nil
+}
+
+// createLicense creates the central-license secret Central picks its license
+// up from.
+func createLicense(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	data, err := cfg.License.load()
+	if err != nil {
+		return err
+	}
+
+	secret := v1.Secret{
+		Data: map[string][]byte{
+			"license.lic": data,
+		},
+	}
+	secret.SetName("central-license")
+	markManaged("Secret", &secret)
+
+	return secretBackend.write(ctx, &secret, false)
+}
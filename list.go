@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// managedKind is a kind of object the installer may create.
+type managedKind struct {
+	kind          string
+	resource      schema.GroupVersionResource
+	clusterScoped bool
+}
+
+var managedKinds = []managedKind{
+	{"Namespace", schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, true},
+	{"PriorityClass", schema.GroupVersionResource{Group: "scheduling.k8s.io", Version: "v1", Resource: "priorityclasses"}, true},
+	{"Deployment", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, false},
+	{"StatefulSet", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, false},
+	{"Service", schema.GroupVersionResource{Version: "v1", Resource: "services"}, false},
+	{"ConfigMap", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, false},
+	{"Secret", schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, false},
+	{"PersistentVolumeClaim", schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, false},
+	{"Ingress", schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, false},
+	{"NetworkPolicy", schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}, false},
+	{"Job", schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, false},
+	{"PodDisruptionBudget", schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}, false},
+	{"Role", schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, false},
+	{"RoleBinding", schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, false},
+	{"ServiceMonitor", serviceMonitorResource, false},
+	{"Route", routeResource, false},
+	{"ExternalSecret", externalSecretResource, false},
+}
+
+// listManaged implements `installer list [central]`, printing every object
+// carrying the installer's managed-by label, cluster scoped ones included.
+func listManaged(ctx context.Context, config *rest.Config, args []string) error {
+	if len(args) > 0 && args[0] != "central" {
+		return fmt.Errorf("unknown set %q, only central is supported", args[0])
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	opts := metav1.ListOptions{LabelSelector: managedByLabel + "=" + managedByValue}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tVERSION\tREVISION")
+	for _, k := range managedKinds {
+		var resources dynamic.ResourceInterface = client.Resource(k.resource)
+		if !k.clusterScoped {
+			resources = client.Resource(k.resource).Namespace(namespace)
+		}
+		list, err := resources.List(ctx, opts)
+		// Custom resources only exist on some clusters
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", k.resource.Resource, err)
+		}
+		for _, obj := range list.Items {
+			labels := obj.GetLabels()
+			ns := obj.GetNamespace()
+			if ns == "" {
+				ns = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.kind, ns, obj.GetName(), labels[versionLabel], labels[revisionLabel])
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// LockFile pins every image to the digest it resolved to when
+// `installer lock` ran. While a lock file is present, apply uses the pinned
+// references and refuses to run if the config now names different images.
+type LockFile struct {
+	Images map[string]LockedImage `json:"images"`
+}
+
+type LockedImage struct {
+	// Image is the reference the config resolved to when locking.
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+func (l LockedImage) Pinned() string {
+	name, _, _ := splitImage(l.Image)
+	return name + "@" + l.Digest
+}
+
+// Tagged is the pinned reference with the locked tag kept, so the tag can be
+// recreated when the image is copied elsewhere.
+func (l LockedImage) Tagged() string {
+	name, tag, _ := splitImage(l.Image)
+	if tag == "" {
+		return l.Pinned()
+	}
+	return name + ":" + tag + "@" + l.Digest
+}
+
+// loadLock reads the lock file at path, if it exists, and makes the config
+// hand out pinned image references.
+func (c *Config) loadLock(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lock := &LockFile{}
+	err = yaml.UnmarshalStrict(data, lock)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	for component, image := range c.imageRefs() {
+		locked, ok := lock.Images[component]
+		if !ok {
+			return fmt.Errorf("%s has no entry for the %s image, re-run `installer lock`", path, component)
+		}
+		if locked.Image != image {
+			return fmt.Errorf("%s image is %s but %s pins %s, re-run `installer lock`", component, image, path, locked.Image)
+		}
+	}
+	c.lock = lock
+
+	return nil
+}
+
+// writeLockFile implements `installer lock`.
+func writeLockFile(ctx context.Context, cfg *Config, path string) error {
+	lock := LockFile{Images: map[string]LockedImage{}}
+
+	refs := cfg.imageRefs()
+	components := make([]string, 0, len(refs))
+	for component := range refs {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	for _, component := range components {
+		image := refs[component]
+		log("Resolving %s", image)
+		digest, err := resolveDigest(ctx, cfg, image)
+		if err != nil {
+			return fmt.Errorf("resolving %s: %w", image, err)
+		}
+		lock.Images[component] = LockedImage{Image: image, Digest: digest}
+	}
+
+	return lock.write(path)
+}
+
+func (l *LockFile) write(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	log("Writing %s", path)
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// relock points the lock file at the mirror the locked images were pushed
+// to. The digests stay, pushing keeps the manifests as they are.
+func (l *LockFile) relock(path, mirror string) error {
+	mirrorCfg := &Config{Registry: mirror}
+	for component, locked := range l.Images {
+		locked.Image = mirrorCfg.resolveImage(locked.Image, "")
+		l.Images[component] = locked
+	}
+
+	return l.write(path)
+}
+
+// resolveDigest asks the image's registry for the digest of its tag,
+// authenticating anonymously or with the pull secret credentials when they
+// are for the image's registry.
+func resolveDigest(ctx context.Context, cfg *Config, image string) (string, error) {
+	name, tag, digest := splitImage(image)
+	if digest != "" {
+		return digest, nil
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+
+	repo := cfg.registryRepo(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, repo.url("manifests/%s", tag), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	resp, err := repo.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned %s", resp.Status)
+	}
+
+	digest = resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.New("registry did not return a digest")
+	}
+
+	return digest, nil
+}
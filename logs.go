@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// components maps the names accepted on the command line to the app label the
+// installer puts on that component's pods.
+var components = map[string]string{
+	"central":           "central",
+	"central-db":        "central-db",
+	"central-db-pooler": poolerName,
+}
+
+// streamLogs implements `installer logs <component>[,<component>...]`. Logs of
+// every matching container are streamed concurrently and, when there is more
+// than one stream, each line is prefixed with the pod and container name.
+func streamLogs(ctx context.Context, client *kubernetes.Clientset, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	previous := fs.Bool("previous", false, "show logs of the previous container instance")
+	since := fs.Duration("since", 0, "only show logs newer than this duration, e.g. 10m")
+	follow := fs.Bool("follow", false, "keep streaming new log lines")
+	prefix := fs.Bool("prefix", true, "prefix each line with pod/container when showing several streams")
+	tail := fs.Int64("tail", -1, "number of recent lines to show per container, -1 for all")
+	timestamps := fs.Bool("timestamps", false, "prefix each line with its timestamp")
+
+	// Accept flags both before and after the component name
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: logs <component>[,<component>...]|all [--previous] [--since <duration>] [--tail <lines>] [--follow]")
+	}
+	names := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+
+	var selected []string
+	if names == "all" {
+		for _, app := range components {
+			selected = append(selected, app)
+		}
+	} else {
+		for _, name := range strings.Split(names, ",") {
+			app, ok := components[name]
+			if !ok {
+				return fmt.Errorf("unknown component %q", name)
+			}
+			selected = append(selected, app)
+		}
+	}
+
+	opts := v1.PodLogOptions{
+		Previous:   *previous,
+		Follow:     *follow,
+		Timestamps: *timestamps,
+	}
+	if *tail >= 0 {
+		opts.TailLines = tail
+	}
+	if *since > 0 {
+		seconds := int64(since.Seconds())
+		opts.SinceSeconds = &seconds
+	}
+
+	type logSource struct {
+		pod       string
+		container string
+	}
+	var sources []logSource
+	for _, app := range selected {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + app + "," + managedByLabel + "=" + managedByValue})
+		if err != nil {
+			return err
+		}
+		// Pods started before the installer labelled them only have the app label
+		if len(pods.Items) == 0 {
+			pods, err = client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + app})
+			if err != nil {
+				return err
+			}
+		}
+		for _, pod := range pods.Items {
+			for _, c := range pod.Spec.Containers {
+				sources = append(sources, logSource{pod: pod.Name, container: c.Name})
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no pods found for %s in namespace %s", names, namespace)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, len(sources))
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src logSource) {
+			defer wg.Done()
+
+			linePrefix := ""
+			if *prefix && len(sources) > 1 {
+				linePrefix = fmt.Sprintf("[%s/%s] ", src.pod, src.container)
+			}
+
+			podOpts := opts
+			podOpts.Container = src.container
+			stream, err := client.CoreV1().Pods(namespace).GetLogs(src.pod, &podOpts).Stream(ctx)
+			if err != nil {
+				errs <- fmt.Errorf("%s/%s: %w", src.pod, src.container, err)
+				return
+			}
+			defer stream.Close()
+
+			scanner := bufio.NewScanner(stream)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				mu.Lock()
+				fmt.Println(linePrefix + scanner.Text())
+				mu.Unlock()
+			}
+			if err := scanner.Err(); err != nil {
+				errs <- fmt.Errorf("%s/%s: %w", src.pod, src.container, err)
+			}
+		}(src)
+	}
+	wg.Wait()
+	close(errs)
+
+	// Report the first failure, if any
+	return <-errs
+}
@@ -5,17 +5,24 @@ import (
 	"flag"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
+const defaultNamespace = "stackrox"
+
+// namespace is where everything is installed, set from the config on startup.
+var namespace = defaultNamespace
+
 func log(msg string, params ...interface{}) {
 	fmt.Printf(msg+"\n", params...)
 }
@@ -27,8 +34,107 @@ func main() {
 	} else {
 		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
+	var confPaths configPaths
+	flag.Var(&confPaths, "conf", "(optional) path to the installer.yaml config file, repeat to layer overrides over a base config")
+	var overrides []override
+	flag.Var(overrideFlag{"set", &overrides}, "set", "override a config value, e.g. central.replicas=2; repeatable")
+	flag.Var(overrideFlag{"set-string", &overrides}, "set-string", "like -set, but the value is always a string")
+	flag.Var(overrideFlag{"set-file", &overrides}, "set-file", "like -set-string, but the value is read from the given file")
+	lockPath := flag.String("lock", "installer.lock.yaml", "image lock file written by the lock action and used when present")
+	prune := flag.Bool("prune", true, "delete previously installed resources that are no longer generated")
+	waitTimeout := flag.Duration("wait", 10*time.Minute, "how long apply waits for a component to become ready before creating the ones that depend on it, 0 to not wait")
+	fromCR := flag.String("from-cr", "", "(optional) path to a StackRox operator Central resource to read the config from instead of -conf")
+	flag.IntVar(&concurrency, "concurrency", concurrency, "how many independent resources apply creates at once")
+	flag.StringVar(&resumeFrom, "resume-from", "", "skip the apply stages before this one after a failed apply: "+strings.Join(stages, ", "))
+	flag.BoolVar(&noClusterScope, "no-cluster-scope", false, "only create objects in the namespace, writing cluster scoped ones to -cluster-scope-out for a cluster admin")
+	flag.StringVar(&clusterScopedOut, "cluster-scope-out", "cluster-scoped.yaml", "file the cluster scoped objects are written to with -no-cluster-scope")
+	flag.StringVar(&onlyGenerators, "only", "", "comma separated generators to run, leaving out all others, e.g. central-deployment")
+	flag.StringVar(&skipGenerators, "skip", "", "comma separated generators to leave out, e.g. namespace when it is pre-provisioned")
+	dryRunMode := flag.String("dry-run", "", `set to "server" to validate every change against the API server without persisting it`)
 	flag.Parse()
 
+	var cfg *Config
+	var err error
+	if *fromCR != "" {
+		if len(confPaths) > 0 || len(overrides) > 0 {
+			panic("-from-cr can't be combined with -conf or -set")
+		}
+		cfg, err = readCentralCR(*fromCR)
+		if err == nil {
+			err = cfg.complete()
+		}
+	} else {
+		cfg, err = readConfig(confPaths, overrides)
+	}
+	if err != nil {
+		panic(err.Error())
+	}
+	if cfg.Namespace != "" {
+		namespace = cfg.Namespace
+	}
+
+	ctx := context.Background()
+
+	// Actions that don't talk to the cluster
+	switch flag.Arg(0) {
+	case "version":
+		printVersion()
+		return
+	case "schema":
+		err = printSchema()
+		if err != nil {
+			panic(err)
+		}
+		return
+	case "completion":
+		err = printCompletion(flag.Args()[1:])
+		if err != nil {
+			panic(err)
+		}
+		return
+	case "env":
+		printEnv(*kubeconfig, confPaths, cfg)
+		return
+	case "lock":
+		err = writeLockFile(ctx, cfg, *lockPath)
+		if err != nil {
+			panic(err)
+		}
+		return
+	case "dev":
+		err = cfg.loadLock(*lockPath)
+		if err == nil {
+			err = devCommand(ctx, cfg, *prune, *waitTimeout, flag.Args()[1:])
+		}
+		if err != nil {
+			panic(err)
+		}
+		return
+	case "endpoints":
+		err = cfg.loadLock(*lockPath)
+		if err == nil {
+			err = printEgressEndpoints(cfg, flag.Args()[1:])
+		}
+		if err != nil {
+			panic(err)
+		}
+		return
+	case "images":
+		err = cfg.loadLock(*lockPath)
+		if err == nil {
+			err = imagesCommand(ctx, cfg, confPaths, *lockPath, flag.Args()[1:])
+		}
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	err = cfg.loadLock(*lockPath)
+	if err != nil {
+		panic(err)
+	}
+
 	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
 		panic(err.Error())
@@ -39,85 +145,371 @@ func main() {
 		panic(err.Error())
 	}
 
-	ctx := context.Background()
-	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if resumeFrom != "" && stageIndex(resumeFrom) < 0 {
+		panic(fmt.Errorf("unknown stage %q, expected one of: %s", resumeFrom, strings.Join(stages, ", ")))
+	}
+
+	switch *dryRunMode {
+	case "":
+	case "server":
+		dryRun = true
+	default:
+		panic(fmt.Errorf("unsupported -dry-run mode %q, only \"server\" is supported", *dryRunMode))
+	}
+
+	switch action := flag.Arg(0); action {
+	case "", "apply":
+		apply(ctx, clientset, config, cfg, *prune, *waitTimeout)
+	case "export":
+		err = exportBundle(ctx, clientset, config, cfg, flag.Args()[1:])
+	case "adopt":
+		err = adopt(ctx, clientset, config, flag.Args()[1:])
+	case "rollback":
+		err = rollback(ctx, clientset, config, flag.Args()[1:], *waitTimeout)
+	case "list":
+		err = listManaged(ctx, config, flag.Args()[1:])
+	case "logs":
+		err = streamLogs(ctx, clientset, flag.Args()[1:])
+	case "port-forward":
+		err = portForward(ctx, clientset, config, flag.Args()[1:])
+	case "preflight":
+		err = runPreflight(ctx, clientset, cfg, flag.Args()[1:])
+	case "status":
+		err = printStatus(ctx, clientset, cfg, flag.Args()[1:])
+	case "support-bundle":
+		err = writeSupportBundle(ctx, clientset, cfg, flag.Args()[1:])
+	case "backup":
+		err = backupDatabase(ctx, clientset, config, flag.Args()[1:])
+	case "restore":
+		err = restoreDatabase(ctx, clientset, config, flag.Args()[1:])
+	default:
+		err = fmt.Errorf("unknown action %q, expected one of: %s", action, strings.Join(actions, ", "))
+	}
 	if err != nil {
-		panic(err.Error())
+		panic(err)
+	}
+}
+
+func apply(ctx context.Context, clientset *kubernetes.Clientset, config *rest.Config, cfg *Config, prune bool, waitTimeout time.Duration) {
+	// Listing every pod needs cluster wide access
+	if !noClusterScope {
+		pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			panic(err.Error())
+		}
+
+		fmt.Printf("There are %d pods in the cluster\n", len(pods.Items))
 	}
 
-	fmt.Printf("There are %d pods in the cluster\n", len(pods.Items))
+	customization = cfg.Customize
+	serviceNetworking = cfg.Networking
+	err := setGeneratorFilter(cfg)
+	if err != nil {
+		panic(err)
+	}
+	secretBackend, err = newSecretStore(clientset, config, cfg)
+	if err != nil {
+		panic(err)
+	}
 
 	// Create the target namespace
-	log("Creating namespace")
-	err = createNamespace(ctx, clientset)
-	if err != nil && !errors.IsAlreadyExists(err) {
+	if generatorEnabled("namespace") {
+		log("Creating namespace")
+		err = createNamespace(ctx, clientset, cfg)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		log("Skipping namespace")
+	}
+
+	// A dry-run namespace is not persisted, so nothing can be validated inside it
+	if dryRun && !noClusterScope {
+		_, err = clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			log("Namespace %s does not exist yet; the resources in it can only be validated once it has been created", namespace)
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if cfg.Platform != "" {
+		err = cfg.applyPlatform(ctx, clientset)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	statefulSet, err := cfg.CentralDB.statefulSet()
+	if err != nil {
+		panic(err)
+	}
+	err = checkWorkloadKindSwitch(ctx, clientset, cfg)
+	if err != nil {
 		panic(err)
 	}
 
-	// Create the central-db PVC
-	log("Creating DB PVC")
-	err = createCentralDbPvc(ctx, clientset)
-	if err != nil && !errors.IsAlreadyExists(err) {
+	// Everything the central-db and central pods mount or reference. None of
+	// these depend on each other.
+	var foundation []step
+	if cfg.PriorityClass != nil {
+		foundation = append(foundation, step{"priority class", func() error {
+			return createPriorityClass(ctx, clientset, cfg)
+		}})
+	}
+	// A StatefulSet brings its own central-db PVC
+	if statefulSet {
+		foundation = append(foundation, step{"DB PVC adoption", func() error {
+			return keepLegacyCentralDbPvc(ctx, clientset)
+		}})
+	} else {
+		foundation = append(foundation, step{"DB PVC", func() error {
+			return createCentralDbPvc(ctx, clientset, cfg)
+		}})
+	}
+	if !cfg.Central.AdminAuth.Disabled {
+		foundation = append(foundation, step{"admin password", func() error {
+			return createAdminPassword(ctx, clientset, cfg)
+		}})
+	}
+	foundation = append(foundation,
+		step{"central DB password", func() error {
+			return createPasswordSecret(ctx, clientset, cfg, "central-db-password")
+		}},
+		step{"TLS certificates", func() error {
+			return createCertificates(ctx, clientset, cfg)
+		}},
+		step{"central DB config", func() error {
+			return createCentralDbConfig(ctx, clientset, cfg)
+		}},
+		step{"central endpoints config", func() error {
+			return createCentralEndpoints(ctx, clientset, cfg)
+		}},
+		step{"central config", func() error {
+			return createCentralConfig(ctx, clientset, cfg)
+		}},
+	)
+	if cfg.ImagePullSecrets.Username != "" {
+		foundation = append(foundation, step{"image pull secret", func() error {
+			return createPullSecret(ctx, clientset, cfg)
+		}})
+	}
+	if len(cfg.AdditionalCAs) > 0 {
+		foundation = append(foundation, step{"additional CA secret", func() error {
+			return createAdditionalCAs(ctx, clientset, cfg)
+		}})
+	}
+	if cfg.License != nil {
+		foundation = append(foundation, step{"license secret", func() error {
+			return createLicense(ctx, clientset, cfg)
+		}})
+	}
+	if !cfg.DeclarativeConfig.empty() {
+		foundation = append(foundation, step{"declarative configuration", func() error {
+			return createDeclarativeConfig(ctx, clientset, cfg)
+		}})
+	}
+	err = runStage("foundation", foundation)
+	if err != nil {
 		panic(err)
 	}
 
-	// Create the secrets
-	log("Creating admin password")
-	err = createAdminPassword(ctx, clientset)
-	if err != nil && !errors.IsAlreadyExists(err) {
+	// The pooler reads the central-db password created above
+	database := []step{
+		{"central DB deployment", func() error {
+			return createCentralDbDeployment(ctx, clientset, cfg)
+		}},
+	}
+	if cfg.CentralDB.ConnectionPooling != nil {
+		database = append(database, step{"central DB connection pooler", func() error {
+			return createConnectionPooler(ctx, clientset, cfg)
+		}})
+	}
+	err = runStage("database", database)
+	if err != nil {
 		panic(err)
 	}
 
-	// Create the central-db deployment
-	log("Creating central DB deployment")
-	err = createCentralDbDeployment(ctx, clientset)
+	// Central runs its migrations on startup and fails if the DB isn't up yet
+	log("Waiting for central DB to become ready")
+	if statefulSet {
+		err = waitForStatefulSet(ctx, clientset, "central-db", waitTimeout)
+	} else {
+		err = waitForDeployment(ctx, clientset, "central-db", waitTimeout)
+	}
 	if err != nil {
 		panic(err)
 	}
 
-	// Create the central deployment
-	log("Creating central deployment")
-	err = createCentralDeployment(ctx, clientset)
+	central := []step{
+		{"central deployment", func() error {
+			return createCentralDeployment(ctx, clientset, cfg)
+		}},
+		{"central services", func() error {
+			return createCentralServices(ctx, clientset, cfg)
+		}},
+	}
+	if cfg.Central.Exposure.Ingress != nil {
+		central = append(central, step{"central ingress", func() error {
+			return createCentralIngress(ctx, clientset, cfg)
+		}})
+	}
+	if cfg.Central.Exposure.Route != nil {
+		central = append(central, step{"central routes", func() error {
+			return createCentralRoutes(ctx, clientset, config, cfg)
+		}})
+	}
+	if cfg.Central.DisruptionBudget != nil {
+		central = append(central, step{"central disruption budget", func() error {
+			return createPodDisruptionBudget(ctx, clientset, "central", cfg.Central.DisruptionBudget)
+		}})
+	}
+	if cfg.Monitoring.enabled() {
+		central = append(central, step{"central monitoring", func() error {
+			return createMonitoring(ctx, clientset, config, cfg)
+		}})
+	}
+	if cfg.NetworkPolicies.Enabled {
+		central = append(central, step{"network policies", func() error {
+			return createNetworkPolicies(ctx, clientset, cfg)
+		}})
+	}
+	err = runStage("central", central)
 	if err != nil {
 		panic(err)
 	}
+
+	log("Waiting for central to become ready")
+	err = waitForDeployment(ctx, clientset, "central", waitTimeout)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(cfg.ExternalBackups) > 0 && generatorEnabled("external-backups") {
+		log("Configuring external backups")
+		switch {
+		case dryRun:
+			log("  skipped, Central's API has no dry run")
+		case waitTimeout == 0:
+			log("  skipped, -wait 0 did not wait for Central to be ready")
+		default:
+			err = createExternalBackups(ctx, clientset, config, cfg)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	if cfg.Central.APIToken != nil && generatorEnabled("api-token") {
+		log("Creating API token")
+		switch {
+		case dryRun:
+			log("  skipped, Central's API has no dry run")
+		case waitTimeout == 0:
+			log("  skipped, -wait 0 did not wait for Central to be ready")
+		default:
+			err = createAPIToken(ctx, clientset, config, cfg)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	if len(cfg.Hooks.PostInstall) > 0 && generatorEnabled("post-install-hooks") {
+		log("Running post-install hooks")
+		if waitTimeout == 0 && !dryRun {
+			log("  skipped, -wait 0 did not wait for Central to be ready")
+		} else {
+			err = runPostInstallHooks(ctx, clientset, cfg)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	// Objects of skipped stages aren't known to this run and would look orphaned
+	if prune && resumeFrom != "" {
+		log("Not pruning, the run was resumed from the %s stage", resumeFrom)
+		prune = false
+	}
+
+	if prune && generatorsFiltered() {
+		log("Not pruning, -only or -skip left out some generators")
+		prune = false
+	}
+
+	// Remove anything left over from previous runs
+	if prune {
+		log("Pruning orphaned resources")
+		err = pruneResources(ctx, clientset, config)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if noClusterScope {
+		err = writeClusterScoped()
+		if err != nil {
+			panic(err)
+		}
+		log("Cluster scoped resources were written to %s for a cluster admin to apply", clusterScopedOut)
+	}
+
+	if dryRun {
+		log("Dry run complete, no changes were persisted")
+		return
+	}
+
+	err = writeJournal(ctx, clientset, cfg)
+	if err != nil {
+		panic(err)
+	}
+	log("Applied revision %s", applyRevision)
 }
 
-func createNamespace(ctx context.Context, client *kubernetes.Clientset) error {
+func createNamespace(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
 	ns := v1.Namespace{}
-	ns.SetName("stackrox")
-	_, err := client.CoreV1().Namespaces().Create(ctx, &ns, metav1.CreateOptions{})
-
-	return err
+	ns.SetName(namespace)
+	markManaged("Namespace", &ns)
+	if noClusterScope {
+		// createOpenShiftMonitoring can't label it later
+		if cfg.Monitoring.OpenShift {
+			ns.Labels[openShiftMonitoringLabel] = "true"
+		}
+		deferClusterScoped(v1.SchemeGroupVersion.WithKind("Namespace"), &ns)
+		return nil
+	}
+	return createIfMissing(ctx, client.CoreV1().Namespaces(), "Namespace", &ns)
 }
 
-func createCentralDbPvc(ctx context.Context, client *kubernetes.Clientset) error {
+func createCentralDbPvc(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
 	pvc := v1.PersistentVolumeClaim{
-		Spec: v1.PersistentVolumeClaimSpec{
-			AccessModes: []v1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-			Resources: v1.VolumeResourceRequirements{
-				Requests: v1.ResourceList{
-					v1.ResourceStorage: resource.MustParse("1Gi"),
-				},
-			},
-		},
+		Spec: cfg.CentralDB.Persistence.claimSpec(),
 	}
 	pvc.SetName("central-db")
-	_, err := client.CoreV1().PersistentVolumeClaims("stackrox").Create(ctx, &pvc, metav1.CreateOptions{})
-
-	return err
+	markManaged("PersistentVolumeClaim", &pvc)
+	return createIfMissing(ctx, client.CoreV1().PersistentVolumeClaims(namespace), "PersistentVolumeClaim", &pvc)
 }
 
-func createAdminPassword(ctx context.Context, client *kubernetes.Clientset) error {
+// createPasswordSecret creates a secret holding a generated password under the
+// "password" key. An existing secret is left alone so passwords stay stable
+// across runs.
+func createPasswordSecret(ctx context.Context, client *kubernetes.Clientset, cfg *Config, name string) error {
+	password, err := generatePassword(cfg, name)
+	if err != nil {
+		return err
+	}
+
 	secret := v1.Secret{
 		StringData: map[string]string{
-			"password": "letmein",
+			"password": password,
 		},
 	}
-	secret.SetName("admin-pass")
-	_, err := client.CoreV1().Secrets("stackrox").Create(ctx, &secret, metav1.CreateOptions{})
-
-	return err
+	secret.SetName(name)
+	markManaged("Secret", &secret)
+	return secretBackend.write(ctx, &secret, true)
 }
 
 type VolumeDefAndMount struct {
@@ -137,7 +529,7 @@ func (v VolumeDefAndMount) Apply(c *v1.Container, spec *v1.PodSpec) {
 	spec.Volumes = append(spec.Volumes, v.Volume)
 }
 
-func createCentralDbDeployment(ctx context.Context, client *kubernetes.Clientset) error {
+func createCentralDbDeployment(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
 	deployment := apps.Deployment{
 		Spec: apps.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
@@ -154,7 +546,7 @@ func createCentralDbDeployment(ctx context.Context, client *kubernetes.Clientset
 				Spec: v1.PodSpec{
 					Containers: []v1.Container{{
 						Name:  "central-db",
-						Image: "quay.io/stackrox-io/central-db:latest",
+						Image: cfg.centralDBImage(),
 						Env: []v1.EnvVar{
 							{
 								Name:  "POSTGRES_HOST_AUTH_METHOD",
@@ -168,7 +560,7 @@ func createCentralDbDeployment(ctx context.Context, client *kubernetes.Clientset
 					}},
 					InitContainers: []v1.Container{{
 						Name:    "init-db",
-						Image:   "quay.io/stackrox-io/central-db:latest",
+						Image:   cfg.centralDBImage(),
 						Command: []string{"init-entrypoint.sh"},
 						Env: []v1.EnvVar{
 							{
@@ -195,7 +587,7 @@ func createCentralDbDeployment(ctx context.Context, client *kubernetes.Clientset
 				VolumeSource: v1.VolumeSource{
 					ConfigMap: &v1.ConfigMapVolumeSource{
 						LocalObjectReference: v1.LocalObjectReference{
-							Name: "central-db-config",
+							Name: centralDbConfigMapName,
 						},
 					},
 				},
@@ -266,13 +658,45 @@ func createCentralDbDeployment(ctx context.Context, client *kubernetes.Clientset
 		v.Apply(&deployment.Spec.Template.Spec.Containers[0], &deployment.Spec.Template.Spec)
 	}
 
-	deployment.SetName("central-db")
-	_, err := client.AppsV1().Deployments("stackrox").Create(ctx, &deployment, metav1.CreateOptions{})
+	cfg.CentralDB.applyPostgresConf(&deployment.Spec.Template.Spec.Containers[0])
+	cfg.CentralDB.Probes.Apply(&deployment.Spec.Template.Spec.Containers[0], centralDbProbe, 600)
+	cfg.CentralDB.Placement.Apply(&deployment.Spec.Template)
+	cfg.CentralDB.applyServiceAccountToken(&deployment.Spec.Template, false)
+	cfg.applyPriorityClass(&deployment.Spec.Template.Spec, cfg.CentralDB.ComponentConfig)
+	cfg.applyPullPolicy(&deployment.Spec.Template.Spec)
+	cfg.applyPullSecrets(&deployment.Spec.Template.Spec)
+	err := cfg.CentralDB.PodSecurity.Apply(&deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
+	err = cfg.applyComponentAntiAffinity(&deployment.Spec.Template.Spec, "central-db")
+	if err != nil {
+		return err
+	}
+	err = addConfigChecksum(ctx, client, &deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
 
-	return err
+	statefulSet, err := cfg.CentralDB.statefulSet()
+	if err != nil {
+		return err
+	}
+	if statefulSet {
+		return createCentralDbStatefulSet(ctx, client, cfg, deployment.Spec.Template)
+	}
+	err = createCentralDbService(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	deployment.Spec.RevisionHistoryLimit = cfg.revisionHistoryLimit()
+	deployment.SetName("central-db")
+	markManaged("Deployment", &deployment)
+	return createOrUpdate(ctx, client.AppsV1().Deployments(namespace), "Deployment", &deployment)
 }
 
-func createCentralDeployment(ctx context.Context, client *kubernetes.Clientset) error {
+func createCentralDeployment(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
 	deployment := apps.Deployment{
 		Spec: apps.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
@@ -289,8 +713,12 @@ func createCentralDeployment(ctx context.Context, client *kubernetes.Clientset)
 				Spec: v1.PodSpec{
 					Containers: []v1.Container{{
 						Name:    "central",
-						Image:   "quay.io/stackrox-io/main:latest",
+						Image:   cfg.mainImage(),
 						Command: []string{"/stackrox/central-entrypoint.sh"},
+						Ports: []v1.ContainerPort{{
+							Name:          "api",
+							ContainerPort: centralAPIPort,
+						}},
 						Env: []v1.EnvVar{
 							{
 								Name: "ROX_NAMESPACE",
@@ -307,6 +735,17 @@ func createCentralDeployment(ctx context.Context, client *kubernetes.Clientset)
 		},
 	}
 
+	endpointPorts, err := cfg.Central.Endpoints.ports()
+	if err != nil {
+		return err
+	}
+	for _, port := range endpointPorts {
+		deployment.Spec.Template.Spec.Containers[0].Ports = append(deployment.Spec.Template.Spec.Containers[0].Ports, v1.ContainerPort{
+			Name:          endpointPortName(port),
+			ContainerPort: port,
+		})
+	}
+
 	trueBool := true
 	volumeMounts := []VolumeDefAndMount{
 		{
@@ -469,13 +908,48 @@ func createCentralDeployment(ctx context.Context, client *kubernetes.Clientset)
 		},
 	}
 
+	if !cfg.DeclarativeConfig.empty() {
+		volumeMounts = append(volumeMounts, declarativeConfigVolumes()...)
+	}
+	if cfg.CentralDB.ConnectionPooling != nil {
+		volumeMounts = append(volumeMounts, connectionPoolerVolumes()...)
+	}
+
 	for _, v := range volumeMounts {
 		v.Apply(&deployment.Spec.Template.Spec.Containers[0], &deployment.Spec.Template.Spec)
 	}
 
-	deployment.SetName("central")
+	cfg.Central.Placement.Apply(&deployment.Spec.Template)
+	cfg.Central.applyServiceAccountToken(&deployment.Spec.Template, true)
+	cfg.applyPriorityClass(&deployment.Spec.Template.Spec, cfg.Central.ComponentConfig)
+	cfg.applyPullPolicy(&deployment.Spec.Template.Spec)
+	cfg.applyPullSecrets(&deployment.Spec.Template.Spec)
+	err = cfg.Central.PodSecurity.Apply(&deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
+	err = cfg.applyComponentAntiAffinity(&deployment.Spec.Template.Spec, "central")
+	if err != nil {
+		return err
+	}
+	err = cfg.Central.Performance.Apply(&deployment.Spec.Template.Spec.Containers[0])
+	if err != nil {
+		return err
+	}
+	cfg.Central.Telemetry.Apply(&deployment.Spec.Template.Spec.Containers[0])
+	cfg.applyOfflineEnv(&deployment.Spec.Template.Spec.Containers[0])
+	cfg.Central.Config.Apply(&deployment.Spec.Template.Spec.Containers[0])
+	cfg.Central.Probes.Apply(&deployment.Spec.Template.Spec.Containers[0], centralProbe, 1200)
+	cfg.Monitoring.Apply(&deployment.Spec.Template.Spec.Containers[0], &deployment.Spec.Template.Spec)
+	err = addConfigChecksum(ctx, client, &deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
 
-	_, err := client.AppsV1().Deployments("stackrox").Create(ctx, &deployment, metav1.CreateOptions{})
+	deployment.Spec.Replicas = cfg.Central.Replicas
+	deployment.Spec.RevisionHistoryLimit = cfg.revisionHistoryLimit()
+	deployment.SetName("central")
+	markManaged("Deployment", &deployment)
 
-	return err
+	return createOrUpdate(ctx, client.AppsV1().Deployments(namespace), "Deployment", &deployment)
 }
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Monitoring makes Central's Prometheus metrics available to a cluster
+// Prometheus. They are served over TLS with the central-monitoring-tls
+// certificate, issued by the StackRox service CA, which Prometheus also
+// presents as its client certificate.
+type Monitoring struct {
+	// PrometheusOperator creates a ServiceMonitor for Central.
+	PrometheusOperator bool `json:"prometheusOperator,omitempty"`
+	// OpenShift additionally lets OpenShift's cluster monitoring stack
+	// discover and scrape the install namespace. Implies PrometheusOperator.
+	OpenShift bool `json:"openshift,omitempty"`
+}
+
+const (
+	metricsPort = 9091
+	// monitoringTLSSecretName holds the metrics endpoint's certificate.
+	monitoringTLSSecretName = "central-monitoring-tls"
+	monitoringTLSPath       = "/run/secrets/stackrox.io/monitoring-tls"
+	// monitoringLabel marks the service ServiceMonitors select.
+	monitoringLabel = "app.kubernetes.io/component"
+	// openShiftMonitoringLabel opts the namespace into cluster monitoring.
+	openShiftMonitoringLabel = "openshift.io/cluster-monitoring"
+)
+
+var serviceMonitorResource = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1",
+	Resource: "servicemonitors",
+}
+
+func (m Monitoring) enabled() bool {
+	return m.PrometheusOperator || m.OpenShift
+}
+
+// Apply opens the TLS metrics port on a container, in place of the plain
+// HTTP one, and mounts its certificate.
+func (m Monitoring) Apply(c *v1.Container, spec *v1.PodSpec) {
+	if !m.enabled() {
+		return
+	}
+	c.Env = append(c.Env,
+		v1.EnvVar{Name: "ROX_METRICS_PORT", Value: "disabled"},
+		v1.EnvVar{Name: "ROX_ENABLE_SECURE_METRICS", Value: "true"},
+		v1.EnvVar{Name: "ROX_SECURE_METRICS_PORT", Value: fmt.Sprintf(":%d", metricsPort)},
+	)
+	c.Ports = append(c.Ports, v1.ContainerPort{
+		Name:          "monitoring",
+		ContainerPort: metricsPort,
+	})
+	VolumeDefAndMount{
+		Name:      "monitoring-tls",
+		MountPath: monitoringTLSPath,
+		ReadOnly:  true,
+		Volume: v1.Volume{
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName: monitoringTLSSecretName,
+					Items: []v1.KeyToPath{
+						{Key: "cert.pem", Path: "tls.crt"},
+						{Key: "key.pem", Path: "tls.key"},
+						{Key: "ca.pem", Path: "ca.pem"},
+					},
+				},
+			},
+		},
+	}.Apply(c, spec)
+}
+
+// createMonitoring creates the central-monitoring service and a
+// ServiceMonitor scraping it, plus what OpenShift's monitoring stack needs to
+// see the namespace.
+func createMonitoring(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, cfg *Config) error {
+	svc := v1.Service{
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{
+				"app": "central",
+			},
+			Ports: []v1.ServicePort{{
+				Name:       "monitoring",
+				Port:       metricsPort,
+				TargetPort: intstr.FromString("monitoring"),
+			}},
+		},
+	}
+	svc.SetName("central-monitoring")
+	svc.SetLabels(map[string]string{monitoringLabel: "monitoring"})
+	markManaged("Service", &svc)
+	err := createService(ctx, client, &svc)
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	monitor := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "ServiceMonitor",
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{monitoringLabel: "monitoring"},
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"port":     "monitoring",
+					"interval": "30s",
+					"scheme":   "https",
+					"tlsConfig": map[string]interface{}{
+						"serverName": fmt.Sprintf("central-monitoring.%s.svc", namespace),
+						"ca":         secretKey(monitoringTLSSecretName, "ca.pem"),
+						"cert":       secretKey(monitoringTLSSecretName, "cert.pem"),
+						"keySecret":  map[string]interface{}{"name": monitoringTLSSecretName, "key": "key.pem"},
+					},
+				},
+			},
+		},
+	}}
+	monitor.SetName("central")
+	markManaged("ServiceMonitor", monitor)
+	err = createOrUpdate(ctx, unstructuredClient{dynamicClient.Resource(serviceMonitorResource).Namespace(namespace)}, "ServiceMonitor", monitor)
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("ServiceMonitor CRD not found, is the Prometheus operator installed? %w", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cfg.Monitoring.OpenShift {
+		return createOpenShiftMonitoring(ctx, client)
+	}
+
+	return nil
+}
+
+// secretKey is a ServiceMonitor SecretOrConfigMap selecting a secret key.
+func secretKey(name, key string) map[string]interface{} {
+	return map[string]interface{}{
+		"secret": map[string]interface{}{"name": name, "key": key},
+	}
+}
+
+// createOpenShiftMonitoring labels the namespace so cluster monitoring picks
+// up its ServiceMonitors and allows cluster Prometheus to discover targets in
+// it.
+func createOpenShiftMonitoring(ctx context.Context, client *kubernetes.Clientset) error {
+	err := labelMonitoredNamespace(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	role := rbac.Role{
+		Rules: []rbac.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"services", "endpoints", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		}},
+	}
+	role.SetName("stackrox-prometheus")
+	markManaged("Role", &role)
+	err = createOrUpdate(ctx, client.RbacV1().Roles(namespace), "Role", &role)
+	if err != nil {
+		return err
+	}
+
+	binding := rbac.RoleBinding{
+		RoleRef: rbac.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     "stackrox-prometheus",
+		},
+		Subjects: []rbac.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      "prometheus-k8s",
+			Namespace: "openshift-monitoring",
+		}},
+	}
+	binding.SetName("stackrox-prometheus")
+	markManaged("RoleBinding", &binding)
+
+	return createOrUpdate(ctx, client.RbacV1().RoleBindings(namespace), "RoleBinding", &binding)
+}
+
+// labelMonitoredNamespace adds openShiftMonitoringLabel to the namespace. With
+// -no-cluster-scope the label is on the namespace in the cluster admin's file
+// instead.
+func labelMonitoredNamespace(ctx context.Context, client *kubernetes.Clientset) error {
+	if noClusterScope {
+		return nil
+	}
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if ns.Labels[openShiftMonitoringLabel] == "true" {
+		return nil
+	}
+
+	labels := ns.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[openShiftMonitoringLabel] = "true"
+	ns.SetLabels(labels)
+	_, err = client.CoreV1().Namespaces().Update(ctx, ns, updateOptions())
+
+	return err
+}
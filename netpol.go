@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NetworkPolicies controls the NetworkPolicy objects generated for each
+// component. Every component policy admits traffic from the pods that need it;
+// the allow-lists add further sources.
+type NetworkPolicies struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// DefaultDeny adds a policy rejecting all ingress to the namespace that
+	// isn't admitted by a component policy.
+	DefaultDeny bool `json:"defaultDeny,omitempty"`
+
+	Central   NetworkPolicyAllowList `json:"central,omitempty"`
+	CentralDB NetworkPolicyAllowList `json:"centralDb,omitempty"`
+}
+
+type NetworkPolicyAllowList struct {
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	AllowedCIDRs      []string `json:"allowedCIDRs,omitempty"`
+}
+
+func (a NetworkPolicyAllowList) peers() []networking.NetworkPolicyPeer {
+	var peers []networking.NetworkPolicyPeer
+	for _, ns := range a.AllowedNamespaces {
+		peers = append(peers, networking.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"kubernetes.io/metadata.name": ns,
+				},
+			},
+		})
+	}
+	for _, cidr := range a.AllowedCIDRs {
+		peers = append(peers, networking.NetworkPolicyPeer{
+			IPBlock: &networking.IPBlock{CIDR: cidr},
+		})
+	}
+
+	return peers
+}
+
+func createNetworkPolicies(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	conf := cfg.NetworkPolicies
+	tcp := v1.ProtocolTCP
+
+	// Central's API. Once it is exposed outside the cluster the traffic
+	// arrives from load balancers and ingress controllers we can't predict,
+	// so the port is opened to everyone.
+	centralFrom := append([]networking.NetworkPolicyPeer{{
+		PodSelector: &metav1.LabelSelector{},
+	}}, conf.Central.peers()...)
+	exposure := cfg.Central.Exposure
+	if exposure.LoadBalancer != nil || exposure.NodePort != nil || exposure.Ingress != nil || exposure.Route != nil {
+		centralFrom = nil
+	}
+	central := networking.NetworkPolicy{
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "central"},
+			},
+			Ingress: []networking.NetworkPolicyIngressRule{{
+				From: centralFrom,
+				Ports: []networking.NetworkPolicyPort{{
+					Protocol: &tcp,
+					Port:     &intstr.IntOrString{Type: intstr.Int, IntVal: centralAPIPort},
+				}},
+			}},
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+		},
+	}
+	if cfg.Monitoring.enabled() {
+		// Prometheus may run in any namespace
+		central.Spec.Ingress = append(central.Spec.Ingress, networking.NetworkPolicyIngressRule{
+			Ports: []networking.NetworkPolicyPort{{
+				Protocol: &tcp,
+				Port:     &intstr.IntOrString{Type: intstr.Int, IntVal: metricsPort},
+			}},
+		})
+	}
+	endpointPorts, err := cfg.Central.Endpoints.ports()
+	if err != nil {
+		return err
+	}
+	for _, port := range endpointPorts {
+		central.Spec.Ingress[0].Ports = append(central.Spec.Ingress[0].Ports, networking.NetworkPolicyPort{
+			Protocol: &tcp,
+			Port:     &intstr.IntOrString{Type: intstr.Int, IntVal: port},
+		})
+	}
+	central.SetName("central")
+
+	// Only central talks to its database
+	centralDb := networking.NetworkPolicy{
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "central-db"},
+			},
+			Ingress: []networking.NetworkPolicyIngressRule{{
+				From: append([]networking.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "central"},
+					},
+				}}, conf.CentralDB.peers()...),
+				Ports: []networking.NetworkPolicyPort{{
+					Protocol: &tcp,
+					Port:     &intstr.IntOrString{Type: intstr.Int, IntVal: 5432},
+				}},
+			}},
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+		},
+	}
+	centralDb.SetName("central-db")
+
+	policies := []*networking.NetworkPolicy{&central, &centralDb}
+
+	// With pooling, central reaches its database through the pooler
+	if cfg.CentralDB.ConnectionPooling != nil {
+		centralDb.Spec.Ingress[0].From = append(centralDb.Spec.Ingress[0].From, networking.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": poolerName},
+			},
+		})
+		pooler := networking.NetworkPolicy{
+			Spec: networking.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": poolerName},
+				},
+				Ingress: []networking.NetworkPolicyIngressRule{{
+					From: []networking.NetworkPolicyPeer{{
+						PodSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"app": "central"},
+						},
+					}},
+					Ports: []networking.NetworkPolicyPort{{
+						Protocol: &tcp,
+						Port:     &intstr.IntOrString{Type: intstr.Int, IntVal: 5432},
+					}},
+				}},
+				PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			},
+		}
+		pooler.SetName(poolerName)
+		policies = append(policies, &pooler)
+	}
+
+	if conf.DefaultDeny {
+		deny := networking.NetworkPolicy{
+			Spec: networking.NetworkPolicySpec{
+				PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+			},
+		}
+		deny.SetName("default-deny")
+		policies = append(policies, &deny)
+	}
+
+	for _, p := range policies {
+		markManaged("NetworkPolicy", p)
+		err := createOrUpdate(ctx, client.NetworkingV1().NetworkPolicies(namespace), "NetworkPolicy", p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// applyOfflineMode turns off everything that would reach out of the cluster
+// on its own: telemetry, and Central's online vulnerability definition and
+// probe updates. Outbound integrations, external backups and audit log
+// destinations, conflict with it like telemetry does.
+func (c *Config) applyOfflineMode() error {
+	if !c.OfflineMode {
+		return nil
+	}
+	if c.Central.Telemetry.Enabled != nil && *c.Central.Telemetry.Enabled {
+		return fmt.Errorf("central.telemetry.enabled can't be set with offlineMode")
+	}
+	if len(c.ExternalBackups) > 0 {
+		return fmt.Errorf("externalBackups can't be set with offlineMode")
+	}
+	if c.Central.AuditLogging.Enabled {
+		return fmt.Errorf("central.auditLogging can't be enabled with offlineMode")
+	}
+	disabled := false
+	c.Central.Telemetry.Enabled = &disabled
+
+	return nil
+}
+
+// applyOfflineEnv sets Central's offline switch.
+func (c *Config) applyOfflineEnv(container *v1.Container) {
+	if !c.OfflineMode {
+		return
+	}
+	container.Env = append(container.Env, v1.EnvVar{
+		Name:  "ROX_OFFLINE_MODE",
+		Value: "true",
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// override is one --set, --set-string or --set-file flag. They are applied in
+// command line order after the config files are merged.
+type override struct {
+	flag  string
+	key   string
+	value string
+}
+
+// overrideFlag adds the overrides of one flag name to a shared list, so their
+// relative order is kept.
+type overrideFlag struct {
+	name string
+	list *[]override
+}
+
+func (f overrideFlag) String() string {
+	return ""
+}
+
+func (f overrideFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	*f.list = append(*f.list, override{flag: f.name, key: key, value: value})
+	return nil
+}
+
+// parse reads the value the way its flag asks for: --set as YAML, so numbers,
+// booleans, null and [a, b] lists work; --set-string verbatim; --set-file as
+// the contents of the named file.
+func (o override) parse() (interface{}, error) {
+	switch o.flag {
+	case "set-string":
+		return o.value, nil
+	case "set-file":
+		data, err := os.ReadFile(o.value)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+
+	var v interface{}
+	err := yaml.Unmarshal([]byte(o.value), &v)
+	return v, err
+}
+
+var keyIndex = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// splitKey splits central.exposure.nodePort.port into its path. A backslash
+// escapes a dot that is part of a key, as in customize.labels.team\.io/owner.
+func splitKey(key string) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			cur.WriteByte('.')
+			i++
+		case key[i] == '.':
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(key[i])
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// applyOverrides sets each override in the merged config values, creating the
+// maps and growing the lists on its path as needed.
+func applyOverrides(values map[string]interface{}, overrides []override) error {
+	for _, o := range overrides {
+		v, err := o.parse()
+		if err != nil {
+			return fmt.Errorf("--%s %s: %w", o.flag, o.key, err)
+		}
+		err = setPath(values, splitKey(o.key), v)
+		if err != nil {
+			return fmt.Errorf("--%s %s: %w", o.flag, o.key, err)
+		}
+	}
+
+	return nil
+}
+
+func setPath(m map[string]interface{}, path []string, v interface{}) error {
+	key := path[0]
+	index := -1
+	if match := keyIndex.FindStringSubmatch(key); match != nil {
+		key = match[1]
+		index, _ = strconv.Atoi(match[2])
+	}
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	if index < 0 {
+		if len(path) == 1 {
+			m[key] = v
+			return nil
+		}
+		child, ok := m[key].(map[string]interface{})
+		if !ok {
+			if m[key] != nil {
+				return fmt.Errorf("%s is not a map", key)
+			}
+			child = map[string]interface{}{}
+			m[key] = child
+		}
+		return setPath(child, path[1:], v)
+	}
+
+	list, ok := m[key].([]interface{})
+	if !ok && m[key] != nil {
+		return fmt.Errorf("%s is not a list", key)
+	}
+	for len(list) <= index {
+		list = append(list, nil)
+	}
+	m[key] = list
+	if len(path) == 1 {
+		list[index] = v
+		return nil
+	}
+	child, ok := list[index].(map[string]interface{})
+	if !ok {
+		if list[index] != nil {
+			return fmt.Errorf("%s[%d] is not a map", key, index)
+		}
+		child = map[string]interface{}{}
+		list[index] = child
+	}
+	return setPath(child, path[1:], v)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"profile", []string{"profile"}},
+		{"central.exposure.nodePort.port", []string{"central", "exposure", "nodePort", "port"}},
+		{`customize.labels.team\.io/owner`, []string{"customize", "labels", "team.io/owner"}},
+		{`a\.b\.c`, []string{"a.b.c"}},
+		{`a\b.c`, []string{`a\b`, "c"}},
+		{`a.b\`, []string{"a", `b\`}},
+		{"hooks.postInstall[1].name", []string{"hooks", "postInstall[1]", "name"}},
+		{"a..b", []string{"a", "", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := splitKey(tt.key)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  string
+		key     string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "creates the maps on its path",
+			key:   "central.exposure.nodePort.port",
+			value: "30000",
+			want:  "central: {exposure: {nodePort: {port: 30000}}}",
+		},
+		{
+			name:   "keeps the other keys",
+			values: "central: {replicas: 1}",
+			key:    "central.telemetry.enabled",
+			value:  "false",
+			want:   "central: {replicas: 1, telemetry: {enabled: false}}",
+		},
+		{
+			name:   "replaces a scalar",
+			values: "profile: dev",
+			key:    "profile",
+			value:  "production",
+			want:   "profile: production",
+		},
+		{
+			name:   "replaces a map with a scalar at the end of the path",
+			values: "centralDb: {persistence: {size: 10Gi}}",
+			key:    "centralDb.persistence",
+			value:  "null",
+			want:   "centralDb: {persistence: null}",
+		},
+		{
+			name:   "descends into null",
+			values: "centralDb: {persistence: null}",
+			key:    "centralDb.persistence.size",
+			value:  "10Gi",
+			want:   "centralDb: {persistence: {size: 10Gi}}",
+		},
+		{
+			name:  "escaped dots",
+			key:   `customize.labels.team\.io/owner`,
+			value: "me",
+			want:  "customize: {labels: {team.io/owner: me}}",
+		},
+		{
+			name:   "sets a list item",
+			values: "hooks: {postInstall: [{name: a}, {name: b}]}",
+			key:    "hooks.postInstall[1].name",
+			value:  "c",
+			want:   "hooks: {postInstall: [{name: a}, {name: c}]}",
+		},
+		{
+			name:   "grows a list with nulls",
+			values: "additionalCAs: [{name: a}]",
+			key:    "additionalCAs[2].name",
+			value:  "c",
+			want:   "additionalCAs: [{name: a}, null, {name: c}]",
+		},
+		{
+			name:  "creates a list",
+			key:   "networking.ipFamilies[0]",
+			value: "IPv6",
+			want:  "networking: {ipFamilies: [IPv6]}",
+		},
+		{
+			name:    "a scalar is not a map",
+			values:  "central: x",
+			key:     "central.replicas",
+			value:   "1",
+			wantErr: true,
+		},
+		{
+			name:    "a map is not a list",
+			values:  "central: {replicas: 1}",
+			key:     "central[0]",
+			value:   "1",
+			wantErr: true,
+		},
+		{
+			name:    "a list item scalar is not a map",
+			values:  "a: [x]",
+			key:     "a[0].b",
+			value:   "1",
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			key:     "central..replicas",
+			value:   "1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := parseValues(t, tt.values)
+			v, err := override{flag: "set", key: tt.key, value: tt.value}.parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = setPath(values, splitKey(tt.key), v)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := parseValues(t, tt.want)
+			if !reflect.DeepEqual(values, want) {
+				t.Errorf("got %#v, want %#v", values, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DisruptionBudget sets exactly one of MinAvailable and MaxUnavailable, either
+// as a number of pods or a percentage.
+type DisruptionBudget struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+func createPodDisruptionBudget(ctx context.Context, client *kubernetes.Clientset, app string, budget *DisruptionBudget) error {
+	if (budget.MinAvailable == nil) == (budget.MaxUnavailable == nil) {
+		return fmt.Errorf("%s disruption budget: exactly one of minAvailable and maxUnavailable must be set", app)
+	}
+
+	pdb := policy.PodDisruptionBudget{
+		Spec: policy.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": app,
+				},
+			},
+			MinAvailable:   budget.MinAvailable,
+			MaxUnavailable: budget.MaxUnavailable,
+		},
+	}
+	pdb.SetName(app)
+	markManaged("PodDisruptionBudget", &pdb)
+
+	return createOrUpdate(ctx, client.PolicyV1().PodDisruptionBudgets(namespace), "PodDisruptionBudget", &pdb)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Performance groups Central's tuning knobs. Size picks a baseline of
+// resources; the remaining fields override individual settings.
+type Performance struct {
+	// Size is one of small, medium or large. Empty leaves Central without
+	// resource requests or limits, as before.
+	Size      string                   `json:"size,omitempty"`
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+	// GCPercent sets GOGC for Central's Go runtime.
+	GCPercent *int `json:"gcPercent,omitempty"`
+	// APIConcurrency caps the concurrent API streams per client connection.
+	APIConcurrency *int `json:"apiConcurrency,omitempty"`
+	// ScanConcurrency caps the images Central scans in parallel.
+	ScanConcurrency *int `json:"scanConcurrency,omitempty"`
+	// ImageCacheSize and DeploymentCacheSize cap the entries of Central's
+	// in-memory image and deployment caches.
+	ImageCacheSize      *int `json:"imageCacheSize,omitempty"`
+	DeploymentCacheSize *int `json:"deploymentCacheSize,omitempty"`
+	// Env holds any further tuning environment variables. It wins over the
+	// fields above when both set a variable.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// settingsEnv maps the typed settings to the Central environment variables
+// they set.
+func (p Performance) settingsEnv() map[string]*int {
+	return map[string]*int{
+		"GOGC":                                 p.GCPercent,
+		"ROX_GRPC_MAX_CONCURRENT_STREAMS":      p.APIConcurrency,
+		"ROX_MAX_PARALLEL_IMAGE_SCAN_INTERNAL": p.ScanConcurrency,
+		"ROX_IMAGE_CACHE_SIZE":                 p.ImageCacheSize,
+		"ROX_DEPLOYMENT_CACHE_SIZE":            p.DeploymentCacheSize,
+	}
+}
+
+// centralSizes are the baseline resources per Size. medium matches the
+// upstream Helm chart defaults.
+var centralSizes = map[string]v1.ResourceRequirements{
+	"small": {
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("500m"),
+			v1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("4Gi"),
+		},
+	},
+	"medium": {
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("1500m"),
+			v1.ResourceMemory: resource.MustParse("4Gi"),
+		},
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("4"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	},
+	"large": {
+		Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("4"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("8"),
+			v1.ResourceMemory: resource.MustParse("16Gi"),
+		},
+	},
+}
+
+func (p Performance) Apply(c *v1.Container) error {
+	if p.Size != "" {
+		size, ok := centralSizes[p.Size]
+		if !ok {
+			return fmt.Errorf("unknown central performance size %q", p.Size)
+		}
+		c.Resources = *size.DeepCopy()
+	}
+	if p.Resources != nil {
+		c.Resources = *p.Resources.DeepCopy()
+	}
+
+	// Keep the Go runtime within the container's limits
+	if _, ok := c.Resources.Limits[v1.ResourceCPU]; ok {
+		c.Env = append(c.Env, v1.EnvVar{
+			Name: "GOMAXPROCS",
+			ValueFrom: &v1.EnvVarSource{
+				ResourceFieldRef: &v1.ResourceFieldSelector{
+					Resource: "limits.cpu",
+				},
+			},
+		})
+	}
+	if mem, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
+		// Leave some headroom for non-heap memory
+		c.Env = append(c.Env, v1.EnvVar{
+			Name:  "GOMEMLIMIT",
+			Value: strconv.FormatInt(mem.Value()*9/10, 10),
+		})
+	}
+
+	env := map[string]string{}
+	for name, value := range p.settingsEnv() {
+		if value != nil {
+			env[name] = strconv.Itoa(*value)
+		}
+	}
+	for name, value := range p.Env {
+		env[name] = value
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.Env = append(c.Env, v1.EnvVar{
+			Name:  name,
+			Value: env[name],
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// platformAuto detects the platform on apply.
+const platformAuto = "auto"
+
+// platformDefaults are what a platform changes about the generated objects.
+// Like profiles, they only fill in what the config leaves unset.
+type platformDefaults struct {
+	// storageClasses are tried in order for the central-db volume; the first
+	// one the cluster has is used.
+	storageClasses []string
+	// loadBalancerAnnotations go on the central-loadbalancer service.
+	loadBalancerAnnotations map[string]string
+	// runtimeDefaultSeccomp sets the RuntimeDefault seccomp profile on pods.
+	// OpenShift's SCCs pick the profile themselves.
+	runtimeDefaultSeccomp bool
+	// runtimeDefaultAppArmor sets the runtime/default AppArmor profile on
+	// containers, on platforms whose nodes all have AppArmor enabled.
+	runtimeDefaultAppArmor bool
+}
+
+var platforms = map[string]platformDefaults{
+	"gke": {
+		storageClasses:         []string{"standard-rwo"},
+		runtimeDefaultSeccomp:  true,
+		runtimeDefaultAppArmor: true,
+	},
+	"eks": {
+		storageClasses: []string{"gp3", "gp2"},
+		loadBalancerAnnotations: map[string]string{
+			"service.beta.kubernetes.io/aws-load-balancer-type": "nlb",
+		},
+		runtimeDefaultSeccomp: true,
+	},
+	"aks": {
+		storageClasses:        []string{"managed-csi"},
+		runtimeDefaultSeccomp: true,
+	},
+	"openshift": {},
+	"k3s": {
+		storageClasses:        []string{"local-path"},
+		runtimeDefaultSeccomp: true,
+	},
+}
+
+func platformNames() []string {
+	names := []string{platformAuto}
+	for name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// detectPlatform recognizes the platform from the API groups and server
+// version, and then from the node labels when nodes may be listed. It returns
+// an empty string for anything else.
+func detectPlatform(ctx context.Context, client *kubernetes.Clientset) (string, error) {
+	groups, err := client.Discovery().ServerGroups()
+	if err != nil {
+		return "", err
+	}
+	for _, g := range groups.Groups {
+		if g.Name == routeResource.Group {
+			return "openshift", nil
+		}
+	}
+
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.Contains(info.GitVersion, "+k3s"):
+		return "k3s", nil
+	case strings.Contains(info.GitVersion, "-gke."):
+		return "gke", nil
+	case strings.Contains(info.GitVersion, "-eks-"):
+		return "eks", nil
+	}
+
+	if noClusterScope {
+		return "", nil
+	}
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes.Items {
+		switch {
+		case node.Labels["kubernetes.azure.com/cluster"] != "" || strings.HasPrefix(node.Spec.ProviderID, "azure://"):
+			return "aks", nil
+		case node.Labels["cloud.google.com/gke-nodepool"] != "":
+			return "gke", nil
+		case node.Labels["eks.amazonaws.com/nodegroup"] != "" || strings.HasPrefix(node.Spec.ProviderID, "aws://"):
+			return "eks", nil
+		}
+	}
+
+	return "", nil
+}
+
+// applyPlatform resolves auto and fills in the platform's defaults. It needs
+// the cluster, so unlike profiles it runs on apply rather than in complete.
+func (c *Config) applyPlatform(ctx context.Context, client *kubernetes.Clientset) error {
+	platform := c.Platform
+	if platform == platformAuto {
+		var err error
+		platform, err = detectPlatform(ctx, client)
+		if err != nil {
+			return err
+		}
+		if platform == "" {
+			log("No known platform detected, using the Kubernetes defaults")
+			return nil
+		}
+		log("Detected platform %s", platform)
+	}
+	defaults, ok := platforms[platform]
+	if !ok {
+		return nil
+	}
+
+	err := c.applyPlatformStorageClass(ctx, client, defaults.storageClasses)
+	if err != nil {
+		return err
+	}
+
+	if lb := c.Central.Exposure.LoadBalancer; lb != nil && len(defaults.loadBalancerAnnotations) > 0 {
+		lb.Annotations = mergeMissing(lb.Annotations, defaults.loadBalancerAnnotations)
+	}
+
+	for _, p := range c.podSecurities() {
+		if defaults.runtimeDefaultSeccomp && p.SeccompProfile == nil {
+			p.SeccompProfile = &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault}
+		}
+		if defaults.runtimeDefaultAppArmor && p.AppArmorProfile == "" {
+			p.AppArmorProfile = "runtime/default"
+		}
+	}
+
+	return nil
+}
+
+// applyPlatformStorageClass picks the first of classes the cluster has for
+// central-db. The class of an existing volume can't change, so after the
+// first install the class of the existing PVC or claim template is kept.
+func (c *Config) applyPlatformStorageClass(ctx context.Context, client *kubernetes.Clientset, classes []string) error {
+	if len(classes) == 0 || noClusterScope {
+		return nil
+	}
+	if c.CentralDB.Persistence != nil && c.CentralDB.Persistence.StorageClassName != nil {
+		return nil
+	}
+
+	existing, found, err := existingCentralDbStorageClass(ctx, client, c.CentralDB)
+	if err != nil {
+		return err
+	}
+	if found {
+		if existing != nil {
+			c.CentralDB.setStorageClass(*existing)
+		}
+		return nil
+	}
+
+	for _, name := range classes {
+		_, err = client.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.CentralDB.setStorageClass(name)
+		return nil
+	}
+
+	return nil
+}
+
+// existingCentralDbStorageClass returns the storage class of the central-db
+// volume the configured workload kind already uses: the StatefulSet's claim
+// template or the Deployment's PVC. found is false on the first install.
+func existingCentralDbStorageClass(ctx context.Context, client *kubernetes.Clientset, db CentralDBConfig) (class *string, found bool, err error) {
+	statefulSet, err := db.statefulSet()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if statefulSet {
+		sts, err := client.AppsV1().StatefulSets(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		for _, claim := range sts.Spec.VolumeClaimTemplates {
+			if claim.Name == "disk" {
+				return claim.Spec.StorageClassName, true, nil
+			}
+		}
+		return nil, true, nil
+	}
+
+	pvc, err := client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return pvc.Spec.StorageClassName, true, nil
+}
+
+func (c *CentralDBConfig) setStorageClass(name string) {
+	if c.Persistence == nil {
+		c.Persistence = &Persistence{}
+	}
+	c.Persistence.StorageClassName = &name
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConnectionPooling configures the pgbouncer deployment Central connects to
+// instead of central-db. Clients and pgbouncer talk TLS with a certificate from
+// the StackRox service CA, so Central can verify it like the database itself,
+// and pgbouncer verifies central-db the same way.
+type ConnectionPooling struct {
+	// PoolMode is transaction (the default), session or statement.
+	PoolMode string `json:"poolMode,omitempty"`
+	// MaxClientConnections defaults to 500.
+	MaxClientConnections int `json:"maxClientConnections,omitempty"`
+	// DefaultPoolSize is the number of server connections per database and
+	// user, 90 by default to match Central's own pool.
+	DefaultPoolSize int `json:"defaultPoolSize,omitempty"`
+	// PodSecurity applies to the pgbouncer pod.
+	PodSecurity PodSecurity `json:"podSecurity,omitempty"`
+}
+
+const (
+	poolerName          = "central-db-pooler"
+	poolerTLSSecretName = "central-db-pooler-tls"
+	// centralExternalDBPath is where Central looks for the connection
+	// settings of a database it doesn't manage itself.
+	centralExternalDBPath = "/etc/ext-db/"
+)
+
+func (p ConnectionPooling) render() (string, error) {
+	mode := p.PoolMode
+	switch mode {
+	case "":
+		mode = "transaction"
+	case "transaction", "session", "statement":
+	default:
+		return "", fmt.Errorf("centralDb.connectionPooling.poolMode %q is not supported, expected transaction, session or statement", mode)
+	}
+	maxClients := p.MaxClientConnections
+	if maxClients == 0 {
+		maxClients = 500
+	}
+	poolSize := p.DefaultPoolSize
+	if poolSize == 0 {
+		poolSize = 90
+	}
+
+	return strings.Join([]string{
+		"[databases]",
+		// pgbouncer doesn't pass on the statement_timeout Central connects
+		// with, so it is set on the server connections instead
+		fmt.Sprintf("* = host=central-db.%s.svc port=5432 connect_query='SET statement_timeout = %d'", namespace, centralDBStatementTimeout),
+		"",
+		"[pgbouncer]",
+		"listen_addr = *",
+		"listen_port = 5432",
+		"auth_type = scram-sha-256",
+		"auth_file = /etc/pgbouncer/userlist.txt",
+		"pool_mode = " + mode,
+		fmt.Sprintf("max_client_conn = %d", maxClients),
+		fmt.Sprintf("default_pool_size = %d", poolSize),
+		// Central's driver uses prepared statements
+		"max_prepared_statements = 200",
+		"ignore_startup_parameters = extra_float_digits,statement_timeout",
+		"client_tls_sslmode = require",
+		"client_tls_cert_file = /run/secrets/stackrox.io/certs/cert.pem",
+		"client_tls_key_file = /run/secrets/stackrox.io/certs/key.pem",
+		"client_tls_ca_file = /run/secrets/stackrox.io/certs/ca.pem",
+		// The service CA issued central-db's certificate too, so the pooler
+		// verifies the database like Central does
+		"server_tls_sslmode = verify-full",
+		"server_tls_ca_file = /run/secrets/stackrox.io/certs/ca.pem",
+		"",
+	}, "\n"), nil
+}
+
+// createConnectionPooler deploys pgbouncer in front of central-db and points
+// Central at it.
+func createConnectionPooler(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	conf, err := cfg.CentralDB.ConnectionPooling.render()
+	if err != nil {
+		return err
+	}
+
+	dbPassword, err := secretBackend.read(ctx, "central-db-password")
+	if err != nil {
+		return err
+	}
+	secret := v1.Secret{
+		StringData: map[string]string{
+			"pgbouncer.ini": conf,
+			"userlist.txt":  fmt.Sprintf("%q %q\n", "postgres", string(dbPassword.Data["password"])),
+		},
+	}
+	secret.SetName(poolerName)
+	markManaged("Secret", &secret)
+	err = secretBackend.write(ctx, &secret, false)
+	if err != nil {
+		return err
+	}
+
+	deployment := apps.Deployment{
+		Spec: apps.DeploymentSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": poolerName,
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app": poolerName,
+					},
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:  "pgbouncer",
+						Image: cfg.pgBouncerImage(),
+						Ports: []v1.ContainerPort{{
+							Name:          "postgresql",
+							ContainerPort: 5432,
+						}},
+					}},
+				},
+			},
+		},
+	}
+	volumeMounts := []VolumeDefAndMount{
+		{
+			Name:      "config",
+			MountPath: "/etc/pgbouncer",
+			ReadOnly:  true,
+			Volume: v1.Volume{
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: poolerName,
+					},
+				},
+			},
+		},
+		{
+			Name:      "certs",
+			MountPath: "/run/secrets/stackrox.io/certs",
+			ReadOnly:  true,
+			Volume: v1.Volume{
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: poolerTLSSecretName,
+					},
+				},
+			},
+		},
+	}
+	for _, v := range volumeMounts {
+		v.Apply(&deployment.Spec.Template.Spec.Containers[0], &deployment.Spec.Template.Spec)
+	}
+
+	err = cfg.CentralDB.ConnectionPooling.PodSecurity.Apply(&deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
+	cfg.CentralDB.Placement.Apply(&deployment.Spec.Template)
+	cfg.CentralDB.applyServiceAccountToken(&deployment.Spec.Template, false)
+	cfg.applyPriorityClass(&deployment.Spec.Template.Spec, cfg.CentralDB.ComponentConfig)
+	cfg.applyPullPolicy(&deployment.Spec.Template.Spec)
+	cfg.applyPullSecrets(&deployment.Spec.Template.Spec)
+	Probes{}.Apply(&deployment.Spec.Template.Spec.Containers[0], poolerProbe, 60)
+	err = addConfigChecksum(ctx, client, &deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
+
+	deployment.Spec.RevisionHistoryLimit = cfg.revisionHistoryLimit()
+	deployment.SetName(poolerName)
+	markManaged("Deployment", &deployment)
+	err = createOrUpdate(ctx, client.AppsV1().Deployments(namespace), "Deployment", &deployment)
+	if err != nil {
+		return err
+	}
+
+	svc := v1.Service{
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{
+				"app": poolerName,
+			},
+			Ports: []v1.ServicePort{{
+				Name:       "postgresql",
+				Port:       5432,
+				TargetPort: intstr.FromString("postgresql"),
+			}},
+		},
+	}
+	svc.SetName(poolerName)
+	markManaged("Service", &svc)
+	err = createService(ctx, client, &svc)
+	if err != nil {
+		return err
+	}
+
+	// Central treats the pooler like an external database
+	cm := v1.ConfigMap{
+		Data: map[string]string{
+			"central-external-db.yaml": fmt.Sprintf("centralDB:\n  external: true\n  source: >\n    host=%s.%s.svc port=5432 user=postgres sslmode=verify-full statement_timeout=%d %s client_encoding=UTF8\n", poolerName, namespace, centralDBStatementTimeout, cfg.Central.Config.DBPool.params()),
+		},
+	}
+	cm.SetName("central-external-db")
+	markManaged("ConfigMap", &cm)
+
+	return createOrUpdate(ctx, client.CoreV1().ConfigMaps(namespace), "ConfigMap", &cm)
+}
+
+// connectionPoolerVolumes mounts the pooler's connection settings into
+// Central.
+func connectionPoolerVolumes() []VolumeDefAndMount {
+	return []VolumeDefAndMount{{
+		Name:      "central-external-db-volume",
+		MountPath: centralExternalDBPath,
+		ReadOnly:  true,
+		Volume: v1.Volume{
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: "central-external-db",
+					},
+				},
+			},
+		},
+	}}
+}
+
+// createCentralDbService gives central-db a stable in-cluster address, used by
+// Central and the pooler.
+func createCentralDbService(ctx context.Context, client *kubernetes.Clientset) error {
+	svc := v1.Service{
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{
+				"app": "central-db",
+			},
+			Ports: []v1.ServicePort{{
+				Name:       "postgresql",
+				Port:       5432,
+				TargetPort: intstr.FromInt(5432),
+			}},
+		},
+	}
+	svc.SetName("central-db")
+	markManaged("Service", &svc)
+
+	return createService(ctx, client, &svc)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// forwardTarget is a port of a component and the local port it is forwarded
+// from by default.
+type forwardTarget struct {
+	app       string
+	podPort   int
+	localPort int
+}
+
+var forwardTargets = map[string]forwardTarget{
+	"central":           {"central", 8443, 8443},
+	"central-db":        {"central-db", 5432, 5432},
+	"central-db-pooler": {poolerName, 5432, 6432},
+}
+
+// portForward implements `installer port-forward [<component>[:<local port>]...]`.
+// Each forward is kept up until interrupted, and reconnected to a new pod
+// when its pod goes away.
+func portForward(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, args []string) error {
+	fs := flag.NewFlagSet("port-forward", flag.ExitOnError)
+	address := fs.String("address", "127.0.0.1", "local address to listen on")
+	fs.Parse(args)
+
+	specs := fs.Args()
+	if len(specs) == 0 {
+		specs = []string{"central"}
+	}
+
+	type forward struct {
+		name string
+		forwardTarget
+	}
+	var forwards []forward
+	for _, spec := range specs {
+		name, port, hasPort := strings.Cut(spec, ":")
+		target, ok := forwardTargets[name]
+		if !ok {
+			return fmt.Errorf("unknown component %q", name)
+		}
+		if hasPort {
+			local, err := strconv.Atoi(port)
+			if err != nil {
+				return fmt.Errorf("invalid local port in %q", spec)
+			}
+			target.localPort = local
+		}
+		forwards = append(forwards, forward{name, target})
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, f := range forwards {
+		wg.Add(1)
+		go func(f forward) {
+			defer wg.Done()
+			superviseForward(ctx, client, config, f.name, *address, f.forwardTarget)
+		}(f)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// superviseForward keeps one forward up until ctx is done.
+func superviseForward(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, name, address string, t forwardTarget) {
+	for ctx.Err() == nil {
+		err := runForward(ctx, client, config, name, address, t)
+		if ctx.Err() != nil {
+			return
+		}
+		log("%s: %v, reconnecting", name, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// runForward forwards to a running pod until the connection is lost or ctx
+// is done.
+func runForward(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, name, address string, t forwardTarget) error {
+	pod, err := runningPod(ctx, client, t.app)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	port, done, err := startPortForward(client, config, pod, address, t.localPort, t.podPort, stop)
+	if err != nil {
+		return err
+	}
+	log("Forwarding %s:%d to %s %s:%d", address, port, name, pod, t.podPort)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		if err == nil {
+			err = fmt.Errorf("port-forward to %s ended", pod)
+		}
+		return err
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// minKubernetesMinor is the oldest Kubernetes 1.x release the generated
+// objects are valid on (policy/v1 PodDisruptionBudgets need 1.21).
+const minKubernetesMinor = 21
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip"
+)
+
+type checkResult struct {
+	Name    string      `json:"name"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// runPreflight implements `installer preflight`, checking that the cluster
+// can run what apply would install. It fails if any check fails; warnings
+// are only reported.
+func runPreflight(ctx context.Context, client *kubernetes.Clientset, cfg *Config, args []string) error {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	output := fs.String("output", "table", "output format, table or json")
+	fs.Parse(args)
+
+	checks := []func(context.Context, *kubernetes.Clientset, *Config) checkResult{
+		checkKubernetesVersion,
+		checkAPIGroups,
+		checkStorageClass,
+		checkPodSecurity,
+		checkResourceHeadroom,
+		checkRegistryReachable,
+		checkCollectorKernel,
+	}
+	results := make([]checkResult, 0, len(checks))
+	failed := false
+	for _, check := range checks {
+		r := check(ctx, client, cfg)
+		failed = failed || r.Status == checkFail
+		results = append(results, r)
+	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(results)
+		if err != nil {
+			return err
+		}
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, r.Message)
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, expected table or json", *output)
+	}
+
+	if failed {
+		return fmt.Errorf("preflight checks failed")
+	}
+
+	return nil
+}
+
+func checkKubernetesVersion(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	r := checkResult{Name: "kubernetes-version"}
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	// Managed offerings report minors like "27+"
+	minor, err := strconv.Atoi(strings.TrimRight(info.Minor, "+"))
+	if err != nil || info.Major != "1" {
+		r.Status, r.Message = checkWarn, fmt.Sprintf("could not parse version %s", info.GitVersion)
+		return r
+	}
+	if minor < minKubernetesMinor {
+		r.Status, r.Message = checkFail, fmt.Sprintf("%s is older than 1.%d", info.GitVersion, minKubernetesMinor)
+		return r
+	}
+	r.Status, r.Message = checkPass, info.GitVersion
+
+	return r
+}
+
+func checkAPIGroups(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	r := checkResult{Name: "api-groups"}
+	groups, err := client.Discovery().ServerGroups()
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	available := map[string]bool{}
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			available[v.GroupVersion] = true
+		}
+	}
+
+	required := []string{"v1", "apps/v1", "networking.k8s.io/v1", "policy/v1", "scheduling.k8s.io/v1", "rbac.authorization.k8s.io/v1"}
+	if cfg.Monitoring.enabled() {
+		required = append(required, serviceMonitorResource.GroupVersion().String())
+	}
+	if cfg.Central.Exposure.Route != nil {
+		required = append(required, routeResource.GroupVersion().String())
+	}
+	var missing []string
+	for _, gv := range required {
+		if !available[gv] {
+			missing = append(missing, gv)
+		}
+	}
+	if len(missing) > 0 {
+		r.Status, r.Message = checkFail, "missing "+strings.Join(missing, ", ")
+		return r
+	}
+	r.Status, r.Message = checkPass, fmt.Sprintf("%d required groups available", len(required))
+
+	return r
+}
+
+func checkStorageClass(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	r := checkResult{Name: "default-storage-class"}
+	classes, err := client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	exists := map[string]bool{}
+	for _, sc := range classes.Items {
+		exists[sc.Name] = true
+	}
+
+	// A configured class is used as is, an empty one binds to a pre-created
+	// volume
+	if p := cfg.CentralDB.Persistence; p != nil && p.StorageClassName != nil {
+		name := *p.StorageClassName
+		switch {
+		case name == "":
+			r.Status, r.Message = checkPass, "storage class disabled, the central-db PVC binds to a pre-created volume"
+		case exists[name]:
+			r.Status, r.Message = checkPass, name
+		default:
+			r.Status, r.Message = checkFail, fmt.Sprintf("StorageClass %s not found, the central-db PVC would stay pending", name)
+		}
+		return r
+	}
+
+	// Apply picks the platform's class when the cluster has it
+	platform := cfg.Platform
+	if platform == platformAuto {
+		platform, err = detectPlatform(ctx, client)
+		if err != nil {
+			r.Status, r.Message = checkFail, err.Error()
+			return r
+		}
+	}
+	for _, name := range platforms[platform].storageClasses {
+		if exists[name] {
+			r.Status, r.Message = checkPass, fmt.Sprintf("%s, the %s default", name, platform)
+			return r
+		}
+	}
+
+	for _, sc := range classes.Items {
+		if sc.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+			r.Status, r.Message = checkPass, sc.Name
+			return r
+		}
+	}
+	r.Status, r.Message = checkFail, "no default StorageClass, the central-db PVC would stay pending"
+
+	return r
+}
+
+func checkPodSecurity(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	r := checkResult{Name: "pod-security"}
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		r.Status, r.Message = checkPass, fmt.Sprintf("namespace %s will be created without a pod security level", namespace)
+		return r
+	}
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	level := ns.Labels["pod-security.kubernetes.io/enforce"]
+	switch level {
+	case "", "privileged", "baseline":
+		r.Status, r.Message = checkPass, fmt.Sprintf("namespace %s enforces %q", namespace, level)
+	default:
+		r.Status, r.Message = checkWarn, fmt.Sprintf("namespace %s enforces %q, pods need matching podSecurity settings", namespace, level)
+	}
+
+	return r
+}
+
+// checkResourceHeadroom compares what is left unrequested on schedulable nodes
+// with what Central requests.
+func checkResourceHeadroom(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	r := checkResult{Name: "resource-headroom"}
+
+	var central v1.Container
+	err := cfg.Central.Performance.Apply(&central)
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	needCPU := central.Resources.Requests.Cpu()
+	needMemory := central.Resources.Requests.Memory()
+	if needCPU.IsZero() && needMemory.IsZero() {
+		r.Status, r.Message = checkSkip, "central has no resource requests configured"
+		return r
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	// Every pod bound to a node holds its requests there, pending ones
+	// included, until it has terminated
+	pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		r.Status, r.Message = checkFail, err.Error()
+		return r
+	}
+	requested := map[string]v1.ResourceList{}
+	for _, pod := range pods.Items {
+		addResources(requested, pod.Spec.NodeName, podRequests(&pod.Spec))
+	}
+
+	// Central needs to fit on a single node
+	var fits []string
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		used := requested[node.Name]
+		freeCPU := node.Status.Allocatable.Cpu().DeepCopy()
+		freeCPU.Sub(*used.Cpu())
+		freeMemory := node.Status.Allocatable.Memory().DeepCopy()
+		freeMemory.Sub(*used.Memory())
+		if freeCPU.Cmp(*needCPU) >= 0 && freeMemory.Cmp(*needMemory) >= 0 {
+			fits = append(fits, node.Name)
+		}
+	}
+	if len(fits) == 0 {
+		r.Status, r.Message = checkFail, fmt.Sprintf("no node has %s CPU and %s memory unrequested", needCPU, needMemory)
+		return r
+	}
+	sort.Strings(fits)
+	r.Status, r.Message = checkPass, fmt.Sprintf("%d node(s) can fit central, e.g. %s", len(fits), fits[0])
+
+	return r
+}
+
+// podRequests is what the scheduler counts a pod as requesting: the larger of
+// its containers' requests and those of any one init container, plus the
+// sidecars (init containers that keep running) started before it, and the
+// pod's overhead.
+func podRequests(spec *v1.PodSpec) v1.ResourceList {
+	total := v1.ResourceList{}
+	for _, c := range spec.Containers {
+		addResourceList(total, c.Resources.Requests)
+	}
+
+	sidecars := v1.ResourceList{}
+	for _, c := range spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			addResourceList(sidecars, c.Resources.Requests)
+			addResourceList(total, c.Resources.Requests)
+			continue
+		}
+		init := sidecars.DeepCopy()
+		addResourceList(init, c.Resources.Requests)
+		for name, q := range init {
+			if q.Cmp(total[name]) > 0 {
+				total[name] = q
+			}
+		}
+	}
+	addResourceList(total, spec.Overhead)
+
+	return total
+}
+
+func addResources(totals map[string]v1.ResourceList, node string, add v1.ResourceList) {
+	if totals[node] == nil {
+		totals[node] = v1.ResourceList{}
+	}
+	addResourceList(totals[node], add)
+}
+
+func addResourceList(total, add v1.ResourceList) {
+	for name, q := range add {
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+// checkRegistryReachable resolves every image against its registry. This runs
+// from the machine running the installer, which is usually but not always on
+// the same network as the cluster.
+func checkRegistryReachable(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	r := checkResult{Name: "registry-reachable"}
+	var problems []string
+	refs := cfg.imageRefs()
+	for _, image := range refs {
+		_, err := resolveDigest(ctx, cfg, image)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", image, err))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		r.Status, r.Message = checkFail, strings.Join(problems, "; ")
+		return r
+	}
+	r.Status, r.Message = checkPass, fmt.Sprintf("%d images resolved from this machine", len(refs))
+
+	return r
+}
+
+func checkCollectorKernel(ctx context.Context, client *kubernetes.Clientset, cfg *Config) checkResult {
+	return checkResult{Name: "collector-kernel", Status: checkSkip, Message: "collector is not installed by this installer"}
+}
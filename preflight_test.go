@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodRequests(t *testing.T) {
+	requests := func(cpu, memory string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpu),
+			v1.ResourceMemory: resource.MustParse(memory),
+		}}
+	}
+	always := v1.ContainerRestartPolicyAlways
+
+	tests := []struct {
+		name       string
+		spec       v1.PodSpec
+		wantCPU    string
+		wantMemory string
+	}{
+		{
+			name: "containers are summed",
+			spec: v1.PodSpec{Containers: []v1.Container{
+				{Resources: requests("100m", "128Mi")},
+				{Resources: requests("200m", "64Mi")},
+			}},
+			wantCPU:    "300m",
+			wantMemory: "192Mi",
+		},
+		{
+			name: "a larger init container wins per resource",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{
+					{Resources: requests("1", "64Mi")},
+					{Resources: requests("100m", "1Gi")},
+				},
+				Containers: []v1.Container{{Resources: requests("500m", "256Mi")}},
+			},
+			wantCPU:    "1",
+			wantMemory: "1Gi",
+		},
+		{
+			name: "smaller init containers don't count",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Resources: requests("100m", "64Mi")}},
+				Containers:     []v1.Container{{Resources: requests("500m", "256Mi")}},
+			},
+			wantCPU:    "500m",
+			wantMemory: "256Mi",
+		},
+		{
+			name: "sidecars add to the containers and later init containers",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{
+					{Resources: requests("100m", "64Mi"), RestartPolicy: &always},
+					{Resources: requests("1", "64Mi")},
+				},
+				Containers: []v1.Container{{Resources: requests("500m", "256Mi")}},
+			},
+			wantCPU:    "1100m",
+			wantMemory: "320Mi",
+		},
+		{
+			name: "overhead",
+			spec: v1.PodSpec{
+				Containers: []v1.Container{{Resources: requests("500m", "256Mi")}},
+				Overhead: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("50m"),
+					v1.ResourceMemory: resource.MustParse("32Mi"),
+				},
+			},
+			wantCPU:    "550m",
+			wantMemory: "288Mi",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := podRequests(&tt.spec)
+			if cpu := got[v1.ResourceCPU]; cpu.Cmp(resource.MustParse(tt.wantCPU)) != 0 {
+				t.Errorf("got %s CPU, want %s", cpu.String(), tt.wantCPU)
+			}
+			if memory := got[v1.ResourceMemory]; memory.Cmp(resource.MustParse(tt.wantMemory)) != 0 {
+				t.Errorf("got %s memory, want %s", memory.String(), tt.wantMemory)
+			}
+		})
+	}
+}
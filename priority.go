@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	scheduling "k8s.io/api/scheduling/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PriorityClass generates a PriorityClass that every component uses unless it
+// sets its own priorityClassName. It keeps StackRox from being evicted before
+// the workloads it monitors when nodes run short of resources.
+type PriorityClass struct {
+	// Name defaults to stackrox-critical.
+	Name string `json:"name,omitempty"`
+	// Value defaults to 1000000, the highest value user classes commonly use
+	// while staying well below the system classes.
+	Value int32 `json:"value,omitempty"`
+}
+
+const (
+	defaultPriorityClassName        = "stackrox-critical"
+	defaultPriorityClassValue int32 = 1000000
+)
+
+func (p *PriorityClass) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return defaultPriorityClassName
+}
+
+// applyPriorityClass sets the pod's priority class: the component's own, or
+// else the generated one.
+func (c *Config) applyPriorityClass(spec *v1.PodSpec, component ComponentConfig) {
+	switch {
+	case component.PriorityClassName != "":
+		spec.PriorityClassName = component.PriorityClassName
+	case c.PriorityClass != nil:
+		spec.PriorityClassName = c.PriorityClass.name()
+	}
+}
+
+// createPriorityClass creates or updates the generated PriorityClass. It is
+// cluster scoped, so it is never pruned.
+func createPriorityClass(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	value := cfg.PriorityClass.Value
+	if value == 0 {
+		value = defaultPriorityClassValue
+	}
+
+	pc := scheduling.PriorityClass{
+		Value:       value,
+		Description: "Keeps StackRox running under node pressure.",
+	}
+	pc.SetName(cfg.PriorityClass.name())
+	markManaged("PriorityClass", &pc)
+	if deferClusterScoped(scheduling.SchemeGroupVersion.WithKind("PriorityClass"), &pc) {
+		return nil
+	}
+
+	// The value is immutable, so an existing class is kept as is
+	return createIfMissing(ctx, client.SchedulingV1().PriorityClasses(), "PriorityClass", &pc)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Probes overrides the timing of a component's probes. Every component gets
+// startup, readiness and liveness probes by default.
+type Probes struct {
+	// Disabled leaves the component without probes.
+	Disabled  bool           `json:"disabled,omitempty"`
+	Startup   *ProbeSettings `json:"startup,omitempty"`
+	Readiness *ProbeSettings `json:"readiness,omitempty"`
+	Liveness  *ProbeSettings `json:"liveness,omitempty"`
+}
+
+// ProbeSettings are the probe fields that may be overridden. Unset ones keep
+// the component's default.
+type ProbeSettings struct {
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      *int32 `json:"timeoutSeconds,omitempty"`
+	PeriodSeconds       *int32 `json:"periodSeconds,omitempty"`
+	FailureThreshold    *int32 `json:"failureThreshold,omitempty"`
+}
+
+func (s *ProbeSettings) apply(p *v1.Probe) {
+	if s == nil {
+		return
+	}
+	if s.InitialDelaySeconds != nil {
+		p.InitialDelaySeconds = *s.InitialDelaySeconds
+	}
+	if s.TimeoutSeconds != nil {
+		p.TimeoutSeconds = *s.TimeoutSeconds
+	}
+	if s.PeriodSeconds != nil {
+		p.PeriodSeconds = *s.PeriodSeconds
+	}
+	if s.FailureThreshold != nil {
+		p.FailureThreshold = *s.FailureThreshold
+	}
+}
+
+// Apply sets probes using handler on c. The startup probe allows for up to
+// startupSeconds before the liveness probe takes over, which covers Central's
+// migrations and Postgres recovering after an unclean shutdown.
+func (p Probes) Apply(c *v1.Container, handler v1.ProbeHandler, startupSeconds int32) {
+	if p.Disabled {
+		return
+	}
+
+	c.StartupProbe = &v1.Probe{
+		ProbeHandler:     handler,
+		TimeoutSeconds:   5,
+		PeriodSeconds:    10,
+		FailureThreshold: startupSeconds / 10,
+	}
+	p.Startup.apply(c.StartupProbe)
+
+	c.ReadinessProbe = &v1.Probe{
+		ProbeHandler:     handler,
+		TimeoutSeconds:   5,
+		PeriodSeconds:    10,
+		FailureThreshold: 3,
+	}
+	p.Readiness.apply(c.ReadinessProbe)
+
+	c.LivenessProbe = &v1.Probe{
+		ProbeHandler:     handler,
+		TimeoutSeconds:   5,
+		PeriodSeconds:    10,
+		FailureThreshold: 6,
+	}
+	p.Liveness.apply(c.LivenessProbe)
+}
+
+var centralProbe = v1.ProbeHandler{
+	HTTPGet: &v1.HTTPGetAction{
+		Path:   "/v1/ping",
+		Port:   intstr.FromString("api"),
+		Scheme: v1.URISchemeHTTPS,
+	},
+}
+
+var centralDbProbe = v1.ProbeHandler{
+	Exec: &v1.ExecAction{
+		Command: []string{"/bin/sh", "-c", "-e", "exec pg_isready -U postgres -h 127.0.0.1 -p 5432"},
+	},
+}
+
+var poolerProbe = v1.ProbeHandler{
+	TCPSocket: &v1.TCPSocketAction{
+		Port: intstr.FromString("postgresql"),
+	},
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Persistence configures the central-db volume.
+type Persistence struct {
+	// Size defaults to 1Gi.
+	Size *resource.Quantity `json:"size,omitempty"`
+	// StorageClassName defaults to the cluster's default storage class.
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+var defaultDbVolumeSize = resource.MustParse("1Gi")
+
+// claimSpec is the spec of the central-db PVC, or of the StatefulSet's claim
+// template.
+func (p *Persistence) claimSpec() v1.PersistentVolumeClaimSpec {
+	size := defaultDbVolumeSize
+	spec := v1.PersistentVolumeClaimSpec{
+		AccessModes: []v1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+	}
+	if p != nil {
+		if p.Size != nil {
+			size = *p.Size
+		}
+		spec.StorageClassName = p.StorageClassName
+	}
+	spec.Resources = v1.VolumeResourceRequirements{
+		Requests: v1.ResourceList{
+			v1.ResourceStorage: size,
+		},
+	}
+
+	return spec
+}
+
+// Profiles set opinionated defaults for a kind of installation. Like the HA
+// preset, they only fill in what the config leaves unset, except that
+// production and hardened always enable network policies.
+//
+//   - demo sizes Central small.
+//   - dev sizes Central small and always pulls images.
+//   - production requires centralDb.persistence.size and Central resource
+//     limits or a size, and enables the HA preset and network policies.
+//   - hardened is production with a security context meeting the restricted
+//     Pod Security Standard on every pod: Central, central-db, the pgbouncer
+//     pooler and the hook Jobs.
+//
+// Persistence and replicas otherwise keep their defaults, and demo and dev
+// leave network policies off unless enabled in the config.
+const (
+	profileDemo       = "demo"
+	profileDev        = "dev"
+	profileProduction = "production"
+	profileHardened   = "hardened"
+)
+
+func (c *Config) applyProfile() error {
+	switch c.Profile {
+	case "":
+	case profileDemo:
+		if c.Central.Performance.Size == "" && c.Central.Performance.Resources == nil {
+			c.Central.Performance.Size = "small"
+		}
+	case profileDev:
+		if c.Central.Performance.Size == "" && c.Central.Performance.Resources == nil {
+			c.Central.Performance.Size = "small"
+		}
+		if c.ImagePullPolicy == "" {
+			c.ImagePullPolicy = v1.PullAlways
+		}
+	case profileProduction, profileHardened:
+		err := c.validateProduction()
+		if err != nil {
+			return err
+		}
+		c.HA = true
+		c.NetworkPolicies.Enabled = true
+		if c.Profile == profileHardened {
+			for _, p := range c.podSecurities() {
+				p.restrict()
+			}
+		}
+	default:
+		return fmt.Errorf("unknown profile %q, expected one of: %s, %s, %s, %s", c.Profile, profileDemo, profileDev, profileProduction, profileHardened)
+	}
+
+	return nil
+}
+
+// validateProduction refuses configs that would put a production install on
+// defaults meant for trying things out.
+func (c *Config) validateProduction() error {
+	p := c.CentralDB.Persistence
+	if p == nil || p.Size == nil {
+		return fmt.Errorf("the %s profile requires centralDb.persistence.size", c.Profile)
+	}
+
+	perf := c.Central.Performance
+	if perf.Resources != nil && len(perf.Resources.Limits) > 0 {
+		return nil
+	}
+	if perf.Size != "" && perf.Resources == nil {
+		return nil
+	}
+	return fmt.Errorf("the %s profile requires central.performance.size or central.performance.resources.limits", c.Profile)
+}
+
+// restrict fills in a security context that satisfies the restricted Pod
+// Security Standard.
+func (p *PodSecurity) restrict() {
+	yes, no := true, false
+	if p.RunAsNonRoot == nil {
+		p.RunAsNonRoot = &yes
+	}
+	if p.AllowPrivilegeEscalation == nil {
+		p.AllowPrivilegeEscalation = &no
+	}
+	if p.DropAllCapabilities == nil {
+		p.DropAllCapabilities = &yes
+	}
+	if p.SeccompProfile == nil {
+		p.SeccompProfile = &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "stackrox-installer"
+	partOfLabel    = "app.kubernetes.io/part-of"
+	partOfValue    = "stackrox"
+	versionLabel   = "app.kubernetes.io/version"
+	// revisionLabel identifies the apply run that last wrote an object.
+	revisionLabel = "stackrox.io/installer-revision"
+)
+
+// applyRevision is the value of revisionLabel for this run. It has
+// millisecond precision, as it names the run's journal entry and a rollback
+// followed by an apply can easily happen within a second.
+var applyRevision = time.Now().UTC().Format("20060102-150405.000")
+
+// versionLabelValue is the installer version, or "devel" when it isn't a
+// valid label value, as for local builds.
+func versionLabelValue() string {
+	version, _ := installerVersion()
+	if len(validation.IsValidLabelValue(version)) > 0 {
+		return "devel"
+	}
+	return version
+}
+
+// managedResources holds the "Kind/name" of every object generated during this
+// run. Anything carrying the managed-by label that isn't in here is an orphan.
+var managedResources = map[string]bool{}
+
+// managedMu guards managedResources, which apply steps fill concurrently.
+var managedMu sync.Mutex
+
+func markManaged(kind string, obj metav1.Object) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[managedByLabel] = managedByValue
+	labels[partOfLabel] = partOfValue
+	labels[versionLabel] = versionLabelValue()
+	labels[revisionLabel] = applyRevision
+	obj.SetLabels(labels)
+
+	// Pods are labelled as the installer's too, so they can be told apart
+	// from other pods with the same app label. The revision label is left
+	// off, it would roll the pods on every run.
+	podLabels := map[string]string{
+		managedByLabel: managedByValue,
+		partOfLabel:    partOfValue,
+	}
+	switch o := obj.(type) {
+	case *apps.Deployment:
+		o.Spec.Template.SetLabels(mergeMissing(podLabels, o.Spec.Template.GetLabels()))
+	case *apps.StatefulSet:
+		o.Spec.Template.SetLabels(mergeMissing(podLabels, o.Spec.Template.GetLabels()))
+	}
+
+	customization.apply(kind, obj)
+	managedMu.Lock()
+	managedResources[kind+"/"+obj.GetName()] = true
+	managedMu.Unlock()
+}
+
+func isOrphan(kind string, obj metav1.Object) bool {
+	managedMu.Lock()
+	defer managedMu.Unlock()
+	return !managedResources[kind+"/"+obj.GetName()]
+}
+
+// pruneResources deletes objects in the install namespace that a previous run
+// created but that are no longer generated. The namespace itself is never
+// pruned since deleting it would take everything else with it.
+func pruneResources(ctx context.Context, client *kubernetes.Clientset, config *rest.Config) error {
+	opts := metav1.ListOptions{LabelSelector: managedByLabel + "=" + managedByValue}
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if isOrphan("Deployment", &d) {
+			log("%s orphaned deployment %s", deleteVerb(), d.Name)
+			err = client.AppsV1().Deployments(namespace).Delete(ctx, d.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, s := range statefulSets.Items {
+		if isOrphan("StatefulSet", &s) {
+			log("%s orphaned statefulset %s", deleteVerb(), s.Name)
+			err = client.AppsV1().StatefulSets(namespace).Delete(ctx, s.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, s := range secrets.Items {
+		if isOrphan("Secret", &s) {
+			log("%s orphaned secret %s", deleteVerb(), s.Name)
+			err = client.CoreV1().Secrets(namespace).Delete(ctx, s.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	configMaps, err := client.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, c := range configMaps.Items {
+		if isOrphan("ConfigMap", &c) {
+			log("%s orphaned config map %s", deleteVerb(), c.Name)
+			err = client.CoreV1().ConfigMaps(namespace).Delete(ctx, c.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range pvcs.Items {
+		if isOrphan("PersistentVolumeClaim", &p) {
+			log("%s orphaned PVC %s", deleteVerb(), p.Name)
+			err = client.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, p.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	services, err := client.CoreV1().Services(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, s := range services.Items {
+		if isOrphan("Service", &s) {
+			log("%s orphaned service %s", deleteVerb(), s.Name)
+			err = client.CoreV1().Services(namespace).Delete(ctx, s.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	ingresses, err := client.NetworkingV1().Ingresses(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, i := range ingresses.Items {
+		if isOrphan("Ingress", &i) {
+			log("%s orphaned ingress %s", deleteVerb(), i.Name)
+			err = client.NetworkingV1().Ingresses(namespace).Delete(ctx, i.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	policies, err := client.NetworkingV1().NetworkPolicies(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range policies.Items {
+		if isOrphan("NetworkPolicy", &p) {
+			log("%s orphaned network policy %s", deleteVerb(), p.Name)
+			err = client.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, p.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	pdbs, err := client.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range pdbs.Items {
+		if isOrphan("PodDisruptionBudget", &p) {
+			log("%s orphaned disruption budget %s", deleteVerb(), p.Name)
+			err = client.PolicyV1().PodDisruptionBudgets(namespace).Delete(ctx, p.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	roles, err := client.RbacV1().Roles(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, r := range roles.Items {
+		if isOrphan("Role", &r) {
+			log("%s orphaned role %s", deleteVerb(), r.Name)
+			err = client.RbacV1().Roles(namespace).Delete(ctx, r.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	bindings, err := client.RbacV1().RoleBindings(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, b := range bindings.Items {
+		if isOrphan("RoleBinding", &b) {
+			log("%s orphaned role binding %s", deleteVerb(), b.Name)
+			err = client.RbacV1().RoleBindings(namespace).Delete(ctx, b.Name, deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	jobs, err := client.BatchV1().Jobs(namespace).List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, j := range jobs.Items {
+		if isOrphan("Job", &j) {
+			log("%s orphaned job %s", deleteVerb(), j.Name)
+			// Jobs orphan their pods unless told otherwise
+			propagation := metav1.DeletePropagationBackground
+			jobOpts := deleteOptions()
+			jobOpts.PropagationPolicy = &propagation
+			err = client.BatchV1().Jobs(namespace).Delete(ctx, j.Name, jobOpts)
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	err = pruneCustomResources(ctx, dynamicClient, serviceMonitorResource, "ServiceMonitor")
+	if err != nil {
+		return err
+	}
+
+	err = pruneCustomResources(ctx, dynamicClient, routeResource, "Route")
+	if err != nil {
+		return err
+	}
+
+	return pruneCustomResources(ctx, dynamicClient, externalSecretResource, "ExternalSecret")
+}
+
+// pruneCustomResources deletes orphans of a resource type that may not exist
+// on every cluster, such as ServiceMonitors, Routes or ExternalSecrets.
+func pruneCustomResources(ctx context.Context, client dynamic.Interface, resource schema.GroupVersionResource, kind string) error {
+	resources := client.Resource(resource).Namespace(namespace)
+	list, err := resources.List(ctx, metav1.ListOptions{LabelSelector: managedByLabel + "=" + managedByValue})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, r := range list.Items {
+		if isOrphan(kind, &r) {
+			log("%s orphaned %s %s", deleteVerb(), kind, r.GetName())
+			err = resources.Delete(ctx, r.GetName(), deleteOptions())
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
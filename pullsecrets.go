@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ImagePullSecrets mirrors the Helm charts' imagePullSecrets settings.
+type ImagePullSecrets struct {
+	// UseExisting lists secrets, created outside the installer, to attach to
+	// every pod.
+	UseExisting []string `json:"useExisting,omitempty"`
+
+	// When Username is set, a "stackrox" dockerconfigjson secret is created
+	// from these credentials and attached as well. Server defaults to the
+	// registry of the main image.
+	Server   string `json:"server,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+const pullSecretName = "stackrox"
+
+func (c *Config) pullSecretNames() []string {
+	names := append([]string{}, c.ImagePullSecrets.UseExisting...)
+	if c.ImagePullSecrets.Username != "" {
+		names = append(names, pullSecretName)
+	}
+
+	return names
+}
+
+// applyPullSecrets attaches the configured pull secrets to spec.
+func (c *Config) applyPullSecrets(spec *v1.PodSpec) {
+	for _, name := range c.pullSecretNames() {
+		spec.ImagePullSecrets = append(spec.ImagePullSecrets, v1.LocalObjectReference{Name: name})
+	}
+}
+
+// registryRepo returns a client for the repository of an image name. The
+// pull secret credentials are only sent to the registry they are for.
+func (c *Config) registryRepo(name string) *registryRepo {
+	host, _ := splitRegistry(name)
+	username, password := c.registryCredentials(host)
+
+	return newRegistryRepo(name, username, password)
+}
+
+// registryCredentials returns the pull secret credentials when host is the
+// registry they are for, and none otherwise.
+func (c *Config) registryCredentials(host string) (string, string) {
+	conf := c.ImagePullSecrets
+	if conf.Username == "" {
+		return "", ""
+	}
+	server, _ := splitRegistry(c.mainImage())
+	if conf.Server != "" {
+		server = strings.TrimPrefix(strings.TrimPrefix(conf.Server, "https://"), "http://")
+		server = strings.SplitN(server, "/", 2)[0]
+	}
+	if dockerHubHosts[server] {
+		server = "registry-1.docker.io"
+	}
+	if server != host {
+		return "", ""
+	}
+
+	return conf.Username, conf.Password
+}
+
+func createPullSecret(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	conf := cfg.ImagePullSecrets
+	server := conf.Server
+	if server == "" {
+		server, _ = splitRegistry(cfg.mainImage())
+		// The key docker login writes, which the kubelet matches Docker Hub
+		// images against
+		if dockerHubHosts[server] {
+			server = "https://index.docker.io/v1/"
+		}
+	}
+
+	auth := map[string]interface{}{
+		"auths": map[string]interface{}{
+			server: map[string]string{
+				"username": conf.Username,
+				"password": conf.Password,
+				"email":    conf.Email,
+				"auth":     base64.StdEncoding.EncodeToString([]byte(conf.Username + ":" + conf.Password)),
+			},
+		},
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+
+	secret := v1.Secret{
+		Type: v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			v1.DockerConfigJsonKey: data,
+		},
+	}
+	secret.SetName(pullSecretName)
+	markManaged("Secret", &secret)
+
+	// Credentials may have been rotated, so always update
+	return secretBackend.write(ctx, &secret, false)
+}
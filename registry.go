@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// registryRepo talks to a single repository through the registry v2 API,
+// answering Bearer and Basic auth challenges as they come up.
+type registryRepo struct {
+	host string
+	repo string
+
+	username string
+	password string
+
+	token string
+	basic bool
+}
+
+// dockerHubHosts are the names Docker Hub goes by in image references. Its
+// registry API is only served from registry-1.docker.io.
+var dockerHubHosts = map[string]bool{
+	"docker.io":            true,
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+}
+
+// splitRegistry splits an image name into the host serving its registry API
+// and the repository path.
+func splitRegistry(name string) (string, string) {
+	host, repo := "registry-1.docker.io", name
+	if i := strings.Index(name, "/"); i >= 0 && isRegistryHost(name[:i]) {
+		host, repo = name[:i], name[i+1:]
+	}
+	if dockerHubHosts[host] {
+		host = "registry-1.docker.io"
+		if !strings.Contains(repo, "/") {
+			repo = "library/" + repo
+		}
+	}
+
+	return host, repo
+}
+
+// newRegistryRepo returns a client for the repository of an image name (the
+// reference without tag or digest).
+func newRegistryRepo(name, username, password string) *registryRepo {
+	host, repo := splitRegistry(name)
+
+	return &registryRepo{
+		host:     host,
+		repo:     repo,
+		username: username,
+		password: password,
+	}
+}
+
+func (r *registryRepo) url(format string, args ...interface{}) string {
+	return fmt.Sprintf("https://%s/v2/%s/", r.host, r.repo) + fmt.Sprintf(format, args...)
+}
+
+func (r *registryRepo) authorize(req *http.Request) {
+	switch {
+	case r.token != "":
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	case r.basic:
+		req.SetBasicAuth(r.username, r.password)
+	}
+}
+
+// do sends req, logging in and retrying once if the registry asks for
+// credentials. Requests with a body must be created with a GetBody.
+func (r *registryRepo) do(req *http.Request) (*http.Response, error) {
+	r.authorize(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	err = r.login(req, resp.Header.Get("Www-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.authorize(req)
+
+	return http.DefaultClient.Do(req)
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// login answers an auth challenge, fetching a token from the registry's token
+// service for Bearer challenges.
+func (r *registryRepo) login(orig *http.Request, challenge string) error {
+	if strings.HasPrefix(challenge, "Basic ") {
+		if r.username == "" {
+			return fmt.Errorf("%s requires credentials", r.host)
+		}
+		r.basic = true
+		return nil
+	}
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		query.Set("scope", params["scope"])
+	}
+
+	req, err := http.NewRequestWithContext(orig.Context(), http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return err
+	}
+	r.token = body.Token
+	if r.token == "" {
+		r.token = body.AccessToken
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// dryRun is set by -dry-run=server. Every write is then sent with the server
+// side dry run option, so admission and validation run without persisting
+// anything.
+var dryRun bool
+
+func createOptions() metav1.CreateOptions {
+	if dryRun {
+		return metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.CreateOptions{}
+}
+
+func updateOptions() metav1.UpdateOptions {
+	if dryRun {
+		return metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.UpdateOptions{}
+}
+
+func deleteOptions() metav1.DeleteOptions {
+	if dryRun {
+		return metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return metav1.DeleteOptions{}
+}
+
+// objectClient is the part of a typed client-go resource client needed to
+// create or update objects of that type.
+type objectClient[T metav1.Object] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Create(ctx context.Context, obj T, opts metav1.CreateOptions) (T, error)
+	Update(ctx context.Context, obj T, opts metav1.UpdateOptions) (T, error)
+}
+
+// createOrUpdate creates obj, or replaces the existing object of that name.
+// preserve may copy server-assigned fields from the existing object that an
+// update must not clear.
+func createOrUpdate[T metav1.Object](ctx context.Context, c objectClient[T], kind string, obj T, preserve ...func(existing, obj T)) error {
+	journalObject(kind, obj)
+	return retryTransient(kind, obj, func() error {
+		// A retry after a failed update starts over, and objects to be
+		// created must not carry a resourceVersion
+		obj.SetResourceVersion("")
+		_, err := c.Create(ctx, obj, createOptions())
+		if err == nil {
+			reportWrite("create", kind, obj)
+			return nil
+		}
+		if !errors.IsAlreadyExists(err) {
+			return err
+		}
+
+		existing, err := c.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		for _, p := range preserve {
+			p(existing, obj)
+		}
+		_, err = c.Update(ctx, obj, updateOptions())
+		if err != nil {
+			return err
+		}
+		reportWrite("update", kind, obj)
+
+		return nil
+	})
+}
+
+// createIfMissing creates obj unless an object of that name already exists,
+// which is left untouched. Used for objects holding generated data, such as
+// passwords, and for objects whose spec is immutable.
+func createIfMissing[T metav1.Object](ctx context.Context, c objectClient[T], kind string, obj T) error {
+	journalObject(kind, obj)
+	return retryTransient(kind, obj, func() error {
+		_, err := c.Create(ctx, obj, createOptions())
+		if errors.IsAlreadyExists(err) {
+			reportWrite("keep", kind, obj)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		reportWrite("create", kind, obj)
+
+		return nil
+	})
+}
+
+// writeBackoff spaces out retries of a write over roughly 15 seconds, long
+// enough to ride out an etcd leader election or a restarting webhook.
+var writeBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+// isTransient tells whether a failed write is worth retrying. Admission
+// webhooks that time out or can't be reached surface as internal errors.
+func isTransient(err error) bool {
+	return errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) ||
+		errors.IsServiceUnavailable(err) ||
+		errors.IsInternalError(err) ||
+		errors.IsConflict(err) ||
+		utilnet.IsConnectionReset(err) ||
+		utilnet.IsProbableEOF(err)
+}
+
+// retryTransient runs write again with backoff for as long as it fails with a
+// transient error.
+func retryTransient(kind string, obj metav1.Object, write func() error) error {
+	return retry.OnError(writeBackoff, func(err error) bool {
+		if !isTransient(err) {
+			return false
+		}
+		log("  retrying %s/%s: %v", kind, obj.GetName(), err)
+		return true
+	}, write)
+}
+
+// reportWrite tells the user what a dry run would have done.
+func reportWrite(verb, kind string, obj metav1.Object) {
+	if !dryRun {
+		return
+	}
+	switch verb {
+	case "create":
+		log("  would create %s/%s", kind, obj.GetName())
+	case "update":
+		log("  would update %s/%s", kind, obj.GetName())
+	case "keep":
+		log("  would keep existing %s/%s", kind, obj.GetName())
+	}
+}
+
+// deleteVerb describes a prune deletion in the log.
+func deleteVerb() string {
+	if dryRun {
+		return "Would delete"
+	}
+	return "Deleting"
+}
+
+// unstructuredClient adapts a dynamic client, used for custom resources, to
+// objectClient.
+type unstructuredClient struct {
+	dynamic.ResourceInterface
+}
+
+func (c unstructuredClient) Get(ctx context.Context, name string, opts metav1.GetOptions) (*unstructured.Unstructured, error) {
+	return c.ResourceInterface.Get(ctx, name, opts)
+}
+
+func (c unstructuredClient) Create(ctx context.Context, obj *unstructured.Unstructured, opts metav1.CreateOptions) (*unstructured.Unstructured, error) {
+	return c.ResourceInterface.Create(ctx, obj, opts)
+}
+
+func (c unstructuredClient) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	return c.ResourceInterface.Update(ctx, obj, opts)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// RouteExposure exposes Central through an OpenShift Route.
+type RouteExposure struct {
+	// Host defaults to the one generated by the router.
+	Host string `json:"host,omitempty"`
+	// Termination is "passthrough" (the default), where clients see Central's
+	// own certificate, or "reencrypt", where the router serves TLSSecret and
+	// re-encrypts to Central.
+	Termination string `json:"termination,omitempty"`
+	// TLSSecret is a kubernetes.io/tls secret in the install namespace with
+	// the certificate the router serves for reencrypt routes. Without it the
+	// router's default certificate is used.
+	TLSSecret   string            `json:"tlsSecret,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// MTLSHost, when set, adds a central-mtls passthrough route for sensors,
+	// which authenticate to Central with client certificates and so can't
+	// go through a reencrypt route.
+	MTLSHost string `json:"mtlsHost,omitempty"`
+}
+
+var routeResource = schema.GroupVersionResource{
+	Group:    "route.openshift.io",
+	Version:  "v1",
+	Resource: "routes",
+}
+
+func createCentralRoutes(ctx context.Context, client *kubernetes.Clientset, config *rest.Config, cfg *Config) error {
+	conf := cfg.Central.Exposure.Route
+
+	tls := map[string]interface{}{
+		"insecureEdgeTerminationPolicy": "Redirect",
+	}
+	switch conf.Termination {
+	case "", "passthrough":
+		tls["termination"] = "passthrough"
+	case "reencrypt":
+		tls["termination"] = "reencrypt"
+		// The router has to trust the certificate Central serves
+		centralTLS, err := client.CoreV1().Secrets(namespace).Get(ctx, "central-tls", metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		tls["destinationCACertificate"] = string(centralTLS.Data["ca.pem"])
+		if conf.TLSSecret != "" {
+			secret, err := client.CoreV1().Secrets(namespace).Get(ctx, conf.TLSSecret, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			tls["certificate"] = string(secret.Data["tls.crt"])
+			tls["key"] = string(secret.Data["tls.key"])
+		}
+	default:
+		return fmt.Errorf("central route: unknown termination %q, expected passthrough or reencrypt", conf.Termination)
+	}
+	if conf.TLSSecret != "" && conf.Termination != "reencrypt" {
+		return fmt.Errorf("central route: tlsSecret only applies to reencrypt routes")
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	routes := unstructuredClient{dynamicClient.Resource(routeResource).Namespace(namespace)}
+
+	route := centralRoute("central", conf.Host, tls)
+	route.SetAnnotations(mergeMissing(nil, conf.Annotations))
+	markManaged("Route", route)
+	err = createOrUpdate(ctx, routes, "Route", route)
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("Route API not found, routes are only available on OpenShift: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if conf.MTLSHost == "" {
+		return nil
+	}
+	mtls := centralRoute("central-mtls", conf.MTLSHost, map[string]interface{}{
+		"termination": "passthrough",
+	})
+	markManaged("Route", mtls)
+
+	return createOrUpdate(ctx, routes, "Route", mtls)
+}
+
+func centralRoute(name, host string, tls map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"to": map[string]interface{}{
+			"kind": "Service",
+			"name": "central",
+		},
+		"port": map[string]interface{}{
+			"targetPort": "https",
+		},
+		"tls": tls,
+	}
+	if host != "" {
+		spec["host"] = host
+	}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "route.openshift.io/v1",
+		"kind":       "Route",
+		"spec":       spec,
+	}}
+	route.SetName(name)
+
+	return route
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// The JSON Schema of installer.yaml is generated from the Config type, so it
+// can't drift from what readConfig accepts. Like yaml.UnmarshalStrict, it
+// rejects unknown fields.
+
+// Types that marshal to something other than their Go shape.
+var schemaOverrides = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(resource.Quantity{}):        {"type": []string{"string", "number"}},
+	reflect.TypeOf(intstr.IntOrString{}):       {"type": []string{"string", "integer"}},
+	reflect.TypeOf(metav1.Duration{}):          {"type": "string"},
+	reflect.TypeOf(metav1.Time{}):              {"type": "string", "format": "date-time"},
+	reflect.TypeOf([]byte{}):                   {"type": "string", "contentEncoding": "base64"},
+	reflect.TypeOf((*interface{})(nil)).Elem(): {},
+}
+
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+// printSchema implements `installer schema`.
+func printSchema() error {
+	g := &schemaGenerator{defs: map[string]interface{}{}}
+	root := g.schemaFor(reflect.TypeOf(Config{}))
+	// Resolved by loadConfigFile before the file is decoded into a Config
+	root["properties"].(map[string]interface{})["include"] = map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "string"},
+	}
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = fmt.Sprintf("StackRox installer config (schema %s)", configSchemaVersion)
+	root["$defs"] = g.defs
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(root)
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	if s, ok := schemaOverrides[t]; ok {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		// The root is inlined, everything else goes to $defs so recursive
+		// types terminate
+		if t == reflect.TypeOf(Config{}) {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = nil
+			g.defs[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+
+	panic(fmt.Errorf("no schema for %s", t))
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	g.addFields(t, props)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// addFields adds the properties of t, inlining embedded structs the way
+// encoding/json does.
+func (g *schemaGenerator) addFields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(embedded, props)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+	}
+}
+
+// schemaName names a type after its package, e.g. core.v1.Toleration, so the
+// various v1 packages don't collide.
+func schemaName(t reflect.Type) string {
+	if t.PkgPath() == "main" {
+		return t.Name()
+	}
+	pkg := t.PkgPath()
+	return path.Base(path.Dir(pkg)) + "." + path.Base(pkg) + "." + t.Name()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/kylape/stackrox-installer/certgen"
+)
+
+// SecretsConfig controls how the installer produces generated secret material.
+type SecretsConfig struct {
+	// Seed, when set, derives every generated password and Central's JWT
+	// key from this value and the secret's name instead of reading random
+	// bytes. Renders using the same seed produce identical secrets, so treat
+	// the seed itself as a secret. The service CA stays random: its
+	// certificate carries its issue time and a randomized signature, so it
+	// could not be reproduced anyway, and it is kept in central-tls and
+	// reused instead.
+	Seed string `json:"seed,omitempty"`
+
+	// Provider is kubernetes (the default), external-secrets or vault, see
+	// newSecretStore.
+	Provider        string                 `json:"provider,omitempty"`
+	ExternalSecrets *ExternalSecretsConfig `json:"externalSecrets,omitempty"`
+	Vault           *VaultConfig           `json:"vault,omitempty"`
+}
+
+// generatePassword returns the password to store in the named secret. Each
+// secret gets its own derivation so one leaked password says nothing about the
+// others.
+func generatePassword(cfg *Config, name string) (string, error) {
+	var raw []byte
+	if cfg.Secrets.Seed != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.Secrets.Seed))
+		mac.Write([]byte(name))
+		raw = mac.Sum(nil)
+	} else {
+		raw = make([]byte, 32)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// generateJWTKey returns Central's JWT signing key, derived from the seed when
+// one is set.
+func generateJWTKey(cfg *Config) ([]byte, error) {
+	if cfg.Secrets.Seed == "" {
+		return certgen.NewJWTKey()
+	}
+
+	return certgen.DeriveJWTKey(hkdf.New(sha256.New, []byte(cfg.Secrets.Seed), nil, []byte("central-tls/jwt-key.pem")))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// The seeded secrets must not change between releases: pipelines rendering
+// with the same seed rely on getting the same secrets, and a change would
+// rotate every one of them on the next apply.
+
+func TestGeneratePasswordSeeded(t *testing.T) {
+	cfg := &Config{Secrets: SecretsConfig{Seed: "installer-test-seed"}}
+	tests := map[string]string{
+		"central-db-password": "eiktfgAxnPT0thoirc3wwNWeVUTyLpMKe1fI4HZSwrI",
+		"admin-pass":          "wglapQXUX0i3n2WUqdp0J0HSPdH5_oZV5c5kYhAxMho",
+	}
+	for name, want := range tests {
+		got, err := generatePassword(cfg, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestGenerateJWTKeySeeded(t *testing.T) {
+	cfg := &Config{Secrets: SecretsConfig{Seed: "installer-test-seed"}}
+	key, err := generateJWTKey(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(key)
+	got := hex.EncodeToString(sum[:])
+	want := "a31b92a0446ff1bfcb70e49b59b05269fc715c01061ec9c6cb6beb0b54236451"
+	if got != want {
+		t.Errorf("got key fingerprint %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Secret providers. With kubernetes the installer writes plain Secrets. With
+// external-secrets it emits an ExternalSecret per secret instead and the
+// values have to be in the secret store already; generated material is
+// discarded. With vault the generated material is written to Vault first and
+// then pulled in through ExternalSecrets the same way.
+const (
+	secretProviderKubernetes      = "kubernetes"
+	secretProviderExternalSecrets = "external-secrets"
+	secretProviderVault           = "vault"
+)
+
+// ExternalSecretsConfig points the generated ExternalSecrets at a secret
+// store set up for the External Secrets Operator.
+type ExternalSecretsConfig struct {
+	StoreName string `json:"storeName"`
+	// StoreKind is SecretStore (the default) or ClusterSecretStore.
+	StoreKind string `json:"storeKind,omitempty"`
+	// KeyPrefix is put in front of the secret's name to form the remote
+	// key. Defaults to stackrox/.
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	// RefreshInterval defaults to 1h.
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+}
+
+// VaultConfig is where generated material is written with the vault
+// provider. The token is read from VAULT_TOKEN.
+type VaultConfig struct {
+	Address string `json:"address"`
+	// Mount is the path of a KV version 2 engine. Defaults to secret.
+	Mount string `json:"mount,omitempty"`
+	// CACert is a PEM file to verify Vault's certificate with.
+	CACert string `json:"caCert,omitempty"`
+}
+
+var externalSecretResource = schema.GroupVersionResource{
+	Group:    "external-secrets.io",
+	Version:  "v1beta1",
+	Resource: "externalsecrets",
+}
+
+// secretStore is where the installer keeps the secrets it generates.
+type secretStore interface {
+	// write creates the secret, or, unless keepExisting is set, replaces it.
+	write(ctx context.Context, secret *v1.Secret, keepExisting bool) error
+	// read returns a secret written before, or a NotFound error.
+	read(ctx context.Context, name string) (*v1.Secret, error)
+	// storesGenerated reports whether write keeps the data it is given,
+	// rather than leaving the values to an external store.
+	storesGenerated() bool
+}
+
+// secretBackend is set up from the config at the start of apply.
+var secretBackend secretStore
+
+func newSecretStore(client *kubernetes.Clientset, config *rest.Config, cfg *Config) (secretStore, error) {
+	switch cfg.Secrets.Provider {
+	case "", secretProviderKubernetes:
+		return kubeSecretStore{client}, nil
+	case secretProviderExternalSecrets, secretProviderVault:
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q, expected one of: %s, %s, %s", cfg.Secrets.Provider, secretProviderKubernetes, secretProviderExternalSecrets, secretProviderVault)
+	}
+
+	es := cfg.Secrets.ExternalSecrets
+	if es == nil || es.StoreName == "" {
+		return nil, fmt.Errorf("the %s secrets provider requires secrets.externalSecrets.storeName", cfg.Secrets.Provider)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	store := &externalSecretStore{
+		client:   client,
+		external: dynamicClient.Resource(externalSecretResource).Namespace(namespace),
+		conf:     *es,
+	}
+	if store.conf.StoreKind == "" {
+		store.conf.StoreKind = "SecretStore"
+	}
+	if store.conf.KeyPrefix == "" {
+		store.conf.KeyPrefix = "stackrox/"
+	}
+	if store.conf.RefreshInterval == "" {
+		store.conf.RefreshInterval = "1h"
+	}
+
+	if cfg.Secrets.Provider == secretProviderVault {
+		store.vault, err = newVaultClient(cfg.Secrets.Vault)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+type kubeSecretStore struct {
+	client *kubernetes.Clientset
+}
+
+func (s kubeSecretStore) write(ctx context.Context, secret *v1.Secret, keepExisting bool) error {
+	if keepExisting {
+		return createIfMissing(ctx, s.client.CoreV1().Secrets(namespace), "Secret", secret)
+	}
+	return createOrUpdate(ctx, s.client.CoreV1().Secrets(namespace), "Secret", secret)
+}
+
+func (s kubeSecretStore) storesGenerated() bool {
+	return true
+}
+
+func (s kubeSecretStore) read(ctx context.Context, name string) (*v1.Secret, error) {
+	return s.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+type externalSecretStore struct {
+	client   *kubernetes.Clientset
+	external dynamic.ResourceInterface
+	conf     ExternalSecretsConfig
+	// vault is nil with the external-secrets provider.
+	vault *vaultClient
+}
+
+func (s *externalSecretStore) write(ctx context.Context, secret *v1.Secret, keepExisting bool) error {
+	key := s.conf.KeyPrefix + secret.Name
+	if s.vault != nil {
+		err := s.writeVault(key, secret, keepExisting)
+		if err != nil {
+			return fmt.Errorf("writing %s to vault: %w", secret.Name, err)
+		}
+	}
+
+	// The target secret carries the installer's labels, so list and prune
+	// see it like any other managed secret
+	template := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      stringMap(secret.Labels),
+			"annotations": stringMap(secret.Annotations),
+		},
+	}
+	if secret.Type != "" {
+		template["type"] = string(secret.Type)
+	}
+	external := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind":       "ExternalSecret",
+		"spec": map[string]interface{}{
+			"refreshInterval": s.conf.RefreshInterval,
+			"secretStoreRef": map[string]interface{}{
+				"name": s.conf.StoreName,
+				"kind": s.conf.StoreKind,
+			},
+			"target": map[string]interface{}{
+				"name":           secret.Name,
+				"creationPolicy": "Owner",
+				"template":       template,
+			},
+			"dataFrom": []interface{}{
+				map[string]interface{}{
+					"extract": map[string]interface{}{"key": key},
+				},
+			},
+		},
+	}}
+	external.SetName(secret.Name)
+	markManaged("ExternalSecret", external)
+	err := createOrUpdate(ctx, unstructuredClient{s.external}, "ExternalSecret", external)
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("ExternalSecret CRD not found, is the External Secrets Operator installed? %w", err)
+	}
+
+	return err
+}
+
+func (s *externalSecretStore) writeVault(key string, secret *v1.Secret, keepExisting bool) error {
+	if keepExisting {
+		_, found, err := s.vault.read(key)
+		if err != nil {
+			return err
+		}
+		if found {
+			reportWrite("keep", "VaultSecret", secret)
+			return nil
+		}
+	}
+	if dryRun {
+		reportWrite("update", "VaultSecret", secret)
+		return nil
+	}
+
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		data[k] = v
+	}
+	return s.vault.write(key, data)
+}
+
+// read returns the secret's values from Vault, or the Secret the operator
+// synced from the store. A secret that has an ExternalSecret but hasn't been
+// synced yet is waited for.
+func (s *externalSecretStore) storesGenerated() bool {
+	return s.vault != nil
+}
+
+func (s *externalSecretStore) read(ctx context.Context, name string) (*v1.Secret, error) {
+	if s.vault != nil {
+		data, found, err := s.vault.read(s.conf.KeyPrefix + name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.NewNotFound(v1.Resource("secrets"), name)
+		}
+		secret := &v1.Secret{Data: map[string][]byte{}}
+		secret.SetName(name)
+		for k, v := range data {
+			secret.Data[k] = []byte(v)
+		}
+		return secret, nil
+	}
+
+	secrets := s.client.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if !errors.IsNotFound(err) || dryRun {
+		return secret, err
+	}
+	_, err = s.external.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.NewNotFound(v1.Resource("secrets"), name)
+	}
+
+	log("  waiting for the External Secrets Operator to sync %s", name)
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, 2*time.Minute, true, func(ctx context.Context) (bool, error) {
+		secret, err = secrets.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("secret %s was not synced from the secret store: %w", name, err)
+	}
+
+	return secret, nil
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// vaultClient reads and writes a KV version 2 engine over Vault's HTTP API.
+type vaultClient struct {
+	address string
+	mount   string
+	token   string
+	client  *http.Client
+}
+
+func newVaultClient(conf *VaultConfig) (*vaultClient, error) {
+	if conf == nil || conf.Address == "" {
+		return nil, fmt.Errorf("the vault secrets provider requires secrets.vault.address")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("the vault secrets provider requires VAULT_TOKEN to be set")
+	}
+
+	tlsConfig := &tls.Config{}
+	if conf.CACert != "" {
+		pem, err := os.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s has no usable certificate", conf.CACert)
+		}
+	}
+
+	mount := conf.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+
+	return &vaultClient{
+		address: strings.TrimSuffix(conf.Address, "/"),
+		mount:   strings.Trim(mount, "/"),
+		token:   token,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+func (v *vaultClient) do(method, key string, body interface{}) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/data/%s", v.address, v.mount, key), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	return v.client.Do(req)
+}
+
+func (v *vaultClient) read(key string) (map[string]string, bool, error) {
+	resp, err := v.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("reading %s: vault returned %s", key, resp.Status)
+	}
+
+	var out struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return out.Data.Data, true, nil
+}
+
+func (v *vaultClient) write(key string, data map[string]string) error {
+	resp, err := v.do(http.MethodPost, key, map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("writing %s: vault returned %s", key, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// PodSecurity holds security settings, mostly needed by storage backends such
+// as NFS or CephFS that require particular group ownership and by clusters
+// that enforce UID ranges or custom seccomp and SELinux profiles.
+type PodSecurity struct {
+	FSGroup             *int64                     `json:"fsGroup,omitempty"`
+	FSGroupChangePolicy *v1.PodFSGroupChangePolicy `json:"fsGroupChangePolicy,omitempty"`
+	SupplementalGroups  []int64                    `json:"supplementalGroups,omitempty"`
+	// Sysctls may only contain sysctls Kubernetes considers safe.
+	Sysctls []v1.Sysctl `json:"sysctls,omitempty"`
+
+	RunAsUser      *int64             `json:"runAsUser,omitempty"`
+	RunAsGroup     *int64             `json:"runAsGroup,omitempty"`
+	RunAsNonRoot   *bool              `json:"runAsNonRoot,omitempty"`
+	SeccompProfile *v1.SeccompProfile `json:"seccompProfile,omitempty"`
+	SELinuxOptions *v1.SELinuxOptions `json:"seLinuxOptions,omitempty"`
+	// AppArmorProfile is runtime/default, localhost/<profile> or
+	// unconfined, and is set on every container through the beta
+	// annotation. Nodes without AppArmor refuse pods that ask for a profile.
+	AppArmorProfile string `json:"appArmorProfile,omitempty"`
+
+	// ReadOnlyRootFilesystem, AllowPrivilegeEscalation and
+	// DropAllCapabilities are set on every container, including init
+	// containers.
+	ReadOnlyRootFilesystem   *bool `json:"readOnlyRootFilesystem,omitempty"`
+	AllowPrivilegeEscalation *bool `json:"allowPrivilegeEscalation,omitempty"`
+	DropAllCapabilities      *bool `json:"dropAllCapabilities,omitempty"`
+}
+
+// podSecurities returns the security settings of every pod the installer
+// generates, for profiles and platforms to fill in.
+func (c *Config) podSecurities() []*PodSecurity {
+	securities := []*PodSecurity{&c.Central.PodSecurity, &c.CentralDB.PodSecurity, &c.Hooks.PodSecurity}
+	if c.CentralDB.ConnectionPooling != nil {
+		securities = append(securities, &c.CentralDB.ConnectionPooling.PodSecurity)
+	}
+	return securities
+}
+
+const appArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+// safeSysctls is the set of namespaced sysctls the kubelet allows by default.
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+	"net.ipv4.tcp_fin_timeout":            true,
+}
+
+func (p PodSecurity) Apply(template *v1.PodTemplateSpec) error {
+	spec := &template.Spec
+	for _, s := range p.Sysctls {
+		if !safeSysctls[s.Name] {
+			return fmt.Errorf("sysctl %s is not in the safe set and would be rejected by the kubelet", s.Name)
+		}
+	}
+
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &v1.PodSecurityContext{}
+	}
+	sc := spec.SecurityContext
+	if p.FSGroup != nil {
+		sc.FSGroup = p.FSGroup
+	}
+	if p.FSGroupChangePolicy != nil {
+		sc.FSGroupChangePolicy = p.FSGroupChangePolicy
+	}
+	sc.SupplementalGroups = append(sc.SupplementalGroups, p.SupplementalGroups...)
+	sc.Sysctls = append(sc.Sysctls, p.Sysctls...)
+	if p.RunAsUser != nil {
+		sc.RunAsUser = p.RunAsUser
+	}
+	if p.RunAsGroup != nil {
+		sc.RunAsGroup = p.RunAsGroup
+	}
+	if p.RunAsNonRoot != nil {
+		sc.RunAsNonRoot = p.RunAsNonRoot
+	}
+	if p.SeccompProfile != nil {
+		sc.SeccompProfile = p.SeccompProfile
+	}
+	if p.SELinuxOptions != nil {
+		sc.SELinuxOptions = p.SELinuxOptions
+	}
+
+	if p.AppArmorProfile != "" {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+			for _, c := range containers {
+				template.Annotations[appArmorAnnotationPrefix+c.Name] = p.AppArmorProfile
+			}
+		}
+	}
+
+	if p.ReadOnlyRootFilesystem == nil && p.AllowPrivilegeEscalation == nil && p.DropAllCapabilities == nil {
+		return nil
+	}
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			c := &containers[i]
+			if c.SecurityContext == nil {
+				c.SecurityContext = &v1.SecurityContext{}
+			}
+			if p.ReadOnlyRootFilesystem != nil {
+				c.SecurityContext.ReadOnlyRootFilesystem = p.ReadOnlyRootFilesystem
+			}
+			if p.AllowPrivilegeEscalation != nil {
+				c.SecurityContext.AllowPrivilegeEscalation = p.AllowPrivilegeEscalation
+			}
+			if p.DropAllCapabilities != nil && *p.DropAllCapabilities {
+				c.SecurityContext.Capabilities = &v1.Capabilities{Drop: []v1.Capability{"ALL"}}
+			}
+		}
+	}
+
+	return nil
+}
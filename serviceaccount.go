@@ -0,0 +1,64 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// serviceAccountTokenExpiration matches the token the kubelet projects when
+// the token is automounted.
+const serviceAccountTokenExpiration int64 = 3607
+
+// applyServiceAccountToken turns off automounting of the service account
+// token, as the CIS benchmark asks for, unless the config turns it back on.
+// A component that talks to the Kubernetes API gets the same token projected
+// explicitly, into its first container only.
+func (c ComponentConfig) applyServiceAccountToken(template *v1.PodTemplateSpec, needsAPI bool) {
+	if c.AutomountServiceAccountToken != nil && *c.AutomountServiceAccountToken {
+		template.Spec.AutomountServiceAccountToken = c.AutomountServiceAccountToken
+		return
+	}
+
+	automount := false
+	template.Spec.AutomountServiceAccountToken = &automount
+	if !needsAPI {
+		return
+	}
+
+	expiration := serviceAccountTokenExpiration
+	token := VolumeDefAndMount{
+		Name:      "kube-api-access",
+		MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+		ReadOnly:  true,
+		Volume: v1.Volume{
+			VolumeSource: v1.VolumeSource{
+				Projected: &v1.ProjectedVolumeSource{
+					Sources: []v1.VolumeProjection{
+						{
+							ServiceAccountToken: &v1.ServiceAccountTokenProjection{
+								Path:              "token",
+								ExpirationSeconds: &expiration,
+							},
+						},
+						{
+							ConfigMap: &v1.ConfigMapProjection{
+								LocalObjectReference: v1.LocalObjectReference{
+									Name: "kube-root-ca.crt",
+								},
+								Items: []v1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+							},
+						},
+						{
+							DownwardAPI: &v1.DownwardAPIProjection{
+								Items: []v1.DownwardAPIVolumeFile{{
+									Path:     "namespace",
+									FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	token.Apply(&template.Spec.Containers[0], &template.Spec)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"sigs.k8s.io/yaml"
+)
+
+// isSOPSEncrypted tells whether a config file was encrypted with SOPS, which
+// adds a top level sops key holding the metadata needed to decrypt it.
+func isSOPSEncrypted(data []byte) bool {
+	var file struct {
+		SOPS map[string]interface{} `json:"sops"`
+	}
+	if yaml.Unmarshal(data, &file) != nil || file.SOPS == nil {
+		return false
+	}
+	_, ok := file.SOPS["mac"]
+	return ok
+}
+
+// decryptSOPS decrypts a config file with the sops binary. Leaving the key
+// handling to sops means age, PGP and the cloud KMS backends all work with the
+// usual SOPS_AGE_KEY_FILE, AWS_PROFILE, etc. environment.
+func decryptSOPS(path string) ([]byte, error) {
+	sops, err := exec.LookPath("sops")
+	if err != nil {
+		return nil, fmt.Errorf("%s is encrypted with SOPS, but the sops binary was not found in PATH", path)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(sops, "--decrypt", "--input-type", "yaml", "--output-type", "yaml", path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s with sops: %w: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+func (c CentralDBConfig) statefulSet() (bool, error) {
+	switch c.WorkloadKind {
+	case "", "Deployment":
+		return false, nil
+	case "StatefulSet":
+		return true, nil
+	default:
+		return false, fmt.Errorf("centralDb.workloadKind %q is not supported, expected Deployment or StatefulSet", c.WorkloadKind)
+	}
+}
+
+// checkWorkloadKindSwitch refuses to switch an install between Deployment and
+// StatefulSet mode unless forced, as the central-db data would be left behind.
+func checkWorkloadKindSwitch(ctx context.Context, client *kubernetes.Clientset, cfg *Config) error {
+	if cfg.CentralDB.ForceWorkloadKindSwitch {
+		return nil
+	}
+	statefulSet, err := cfg.CentralDB.statefulSet()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.AppsV1().StatefulSets(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if err == nil {
+		if statefulSet {
+			// Already switched, the PVC is kept around after that
+			return nil
+		}
+		return fmt.Errorf("central-db runs as a StatefulSet and its data is not migrated to a Deployment, set centralDb.forceWorkloadKindSwitch to switch anyway")
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	if !statefulSet {
+		return nil
+	}
+
+	_, err = client.AppsV1().Deployments(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if err == nil {
+		return fmt.Errorf("central-db runs as a Deployment and its data is not migrated to a StatefulSet, set centralDb.forceWorkloadKindSwitch to switch anyway")
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	_, err = client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if err == nil {
+		return fmt.Errorf("PVC central-db from Deployment mode exists and its data is not migrated to a StatefulSet, set centralDb.forceWorkloadKindSwitch to switch anyway")
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// checkClaimTemplate makes sure claim matches the claim template of an
+// existing central-db StatefulSet. Claim templates are immutable, so a changed
+// size or storage class can only be applied to the PVC itself.
+func checkClaimTemplate(ctx context.Context, client *kubernetes.Clientset, claim v1.PersistentVolumeClaim) error {
+	sts, err := client.AppsV1().StatefulSets(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range sts.Spec.VolumeClaimTemplates {
+		if existing.Name != claim.Name {
+			continue
+		}
+		have := existing.Spec.Resources.Requests[v1.ResourceStorage]
+		want := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		if have.Cmp(want) != 0 {
+			return fmt.Errorf("centralDb.persistence.size is %s but the central-db StatefulSet was created with %s and its claim template can't change, resize PVC %s-central-db-0 instead", want.String(), have.String(), claim.Name)
+		}
+		if claim.Spec.StorageClassName != nil && !equalStringPtr(claim.Spec.StorageClassName, existing.Spec.StorageClassName) {
+			return fmt.Errorf("centralDb.persistence.storageClassName is %q but the central-db StatefulSet was created with %s and its claim template can't change", *claim.Spec.StorageClassName, describeStorageClass(existing.Spec.StorageClassName))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("the central-db StatefulSet has no %s claim template and its claim templates can't change, delete it to recreate it", claim.Name)
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func describeStorageClass(class *string) string {
+	if class == nil {
+		return "the default storage class"
+	}
+	return fmt.Sprintf("%q", *class)
+}
+
+// createCentralDbStatefulSet runs the given central-db pod template as a
+// StatefulSet, replacing its disk volume with a claim template.
+func createCentralDbStatefulSet(ctx context.Context, client *kubernetes.Clientset, cfg *Config, template v1.PodTemplateSpec) error {
+	volumes := template.Spec.Volumes[:0]
+	for _, v := range template.Spec.Volumes {
+		if v.Name != "disk" {
+			volumes = append(volumes, v)
+		}
+	}
+	template.Spec.Volumes = volumes
+
+	svc := v1.Service{
+		Spec: v1.ServiceSpec{
+			ClusterIP: v1.ClusterIPNone,
+			Selector: map[string]string{
+				"app": "central-db",
+			},
+			Ports: []v1.ServicePort{{
+				Name:       "postgresql",
+				Port:       5432,
+				TargetPort: intstr.FromInt(5432),
+			}},
+		},
+	}
+	svc.SetName("central-db")
+	markManaged("Service", &svc)
+	err := createService(ctx, client, &svc)
+	if err != nil {
+		return err
+	}
+
+	claim := v1.PersistentVolumeClaim{
+		Spec: cfg.CentralDB.Persistence.claimSpec(),
+	}
+	claim.SetName("disk")
+	err = checkClaimTemplate(ctx, client, claim)
+	if err != nil {
+		return err
+	}
+
+	replicas := int32(1)
+	sts := apps.StatefulSet{
+		Spec: apps.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: "central-db",
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "central-db",
+				},
+			},
+			Template:             template,
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{claim},
+			UpdateStrategy: apps.StatefulSetUpdateStrategy{
+				Type: apps.RollingUpdateStatefulSetStrategyType,
+			},
+			RevisionHistoryLimit: cfg.revisionHistoryLimit(),
+		},
+	}
+	sts.SetName("central-db")
+	markManaged("StatefulSet", &sts)
+
+	// Keep the claim templates as the API server stored them, defaults
+	// included, as any difference fails the update
+	keepClaimTemplates := func(existing, sts *apps.StatefulSet) {
+		sts.Spec.VolumeClaimTemplates = existing.Spec.VolumeClaimTemplates
+	}
+	return createOrUpdate(ctx, client.AppsV1().StatefulSets(namespace), "StatefulSet", &sts, keepClaimTemplates)
+}
+
+// keepLegacyCentralDbPvc stops prune from deleting the PVC the Deployment mode
+// used after switching to StatefulSet mode. Its data is not migrated, but it
+// is left for the user to copy over or delete.
+func keepLegacyCentralDbPvc(ctx context.Context, client *kubernetes.Clientset) error {
+	pvc, err := client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, "central-db", metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log("  keeping PVC central-db from Deployment mode, its data is not used by the StatefulSet")
+	markManaged("PersistentVolumeClaim", pvc)
+
+	return nil
+}
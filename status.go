@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type statusRow struct {
+	kind    string
+	name    string
+	healthy bool
+	details string
+}
+
+// printStatus implements `installer status [central]`, checking the pieces of
+// an install in the order they are needed and printing a summary table.
+func printStatus(ctx context.Context, client *kubernetes.Clientset, cfg *Config, args []string) error {
+	if len(args) > 0 && args[0] != "central" {
+		return fmt.Errorf("unknown set %q, only central is supported", args[0])
+	}
+
+	var rows []statusRow
+
+	secrets := []string{"central-db-password", "central-tls", "central-db-tls"}
+	// There is no admin password with admin auth disabled
+	if !cfg.Central.AdminAuth.Disabled {
+		secrets = append([]string{"admin-pass"}, secrets...)
+	}
+	for _, name := range secrets {
+		_, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			rows = append(rows, statusRow{"Secret", name, true, "present"})
+		case errors.IsNotFound(err):
+			rows = append(rows, statusRow{"Secret", name, false, "missing"})
+		default:
+			return err
+		}
+	}
+
+	// In StatefulSet mode the claim comes from the disk claim template
+	pvcName := "central-db"
+	pvc, err := client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		pvcName = "disk-central-db-0"
+		pvc, err = client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	}
+	switch {
+	case err == nil:
+		rows = append(rows, statusRow{"PersistentVolumeClaim", pvcName, pvc.Status.Phase == v1.ClaimBound, string(pvc.Status.Phase)})
+	case errors.IsNotFound(err):
+		rows = append(rows, statusRow{"PersistentVolumeClaim", "central-db", false, "missing"})
+	default:
+		return err
+	}
+
+	for _, name := range []string{"central-db", "central"} {
+		row, err := deploymentStatus(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	// Go through the API server's service proxy so this works without exposure
+	body, err := client.CoreV1().Services(namespace).ProxyGet("https", "central", "443", "/v1/ping", nil).DoRaw(ctx)
+	if err != nil {
+		rows = append(rows, statusRow{"API", "central /v1/ping", false, err.Error()})
+	} else {
+		rows = append(rows, statusRow{"API", "central /v1/ping", true, string(body)})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tHEALTHY\tDETAILS")
+	allHealthy := true
+	for _, r := range rows {
+		allHealthy = allHealthy && r.healthy
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", r.kind, r.name, r.healthy, r.details)
+	}
+	w.Flush()
+
+	if !allHealthy {
+		return fmt.Errorf("install in namespace %s is not healthy", namespace)
+	}
+
+	return nil
+}
+
+func deploymentStatus(ctx context.Context, client *kubernetes.Clientset, name string) (statusRow, error) {
+	deployment, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return statefulSetStatus(ctx, client, name)
+	}
+	if err != nil {
+		return statusRow{}, err
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + name})
+	if err != nil {
+		return statusRow{}, err
+	}
+	var restarts int32
+	for _, pod := range pods.Items {
+		for _, c := range pod.Status.ContainerStatuses {
+			restarts += c.RestartCount
+		}
+	}
+
+	return statusRow{
+		kind:    "Deployment",
+		name:    name,
+		healthy: deployment.Status.AvailableReplicas >= desired,
+		details: fmt.Sprintf("%d/%d available, %d restarts", deployment.Status.AvailableReplicas, desired, restarts),
+	}, nil
+}
+
+// statefulSetStatus reports on central-db when it runs in StatefulSet mode.
+func statefulSetStatus(ctx context.Context, client *kubernetes.Clientset, name string) (statusRow, error) {
+	sts, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return statusRow{"Deployment", name, false, "missing"}, nil
+	}
+	if err != nil {
+		return statusRow{}, err
+	}
+
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+
+	return statusRow{
+		kind:    "StatefulSet",
+		name:    name,
+		healthy: sts.Status.AvailableReplicas >= desired,
+		details: fmt.Sprintf("%d/%d available", sts.Status.AvailableReplicas, desired),
+	}, nil
+}
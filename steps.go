@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// concurrency is set by -concurrency and bounds how many steps of a stage
+// apply runs at once.
+var concurrency = 4
+
+// stages lists the stages of apply in order. A failed apply can be resumed at
+// the stage that failed with -resume-from.
+var stages = []string{"foundation", "database", "central"}
+
+// resumeFrom is set by -resume-from. Stages before it are skipped.
+var resumeFrom string
+
+func stageIndex(name string) int {
+	for i, s := range stages {
+		if s == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// step is one unit of apply, usually creating the objects of one component.
+type step struct {
+	desc string
+	run  func() error
+}
+
+// name is how -only and -skip refer to the step: its description in lower
+// case with dashes, e.g. central-db-deployment.
+func (s step) name() string {
+	return strings.ToLower(strings.ReplaceAll(s.desc, " ", "-"))
+}
+
+// runStage runs steps that don't depend on each other, up to concurrency of
+// them at a time, unless the stage is skipped by -resume-from. Steps left out
+// by -only or -skip don't run. Every step is run to completion, and the first
+// error in stage order is returned.
+func runStage(name string, steps []step) error {
+	if resumeFrom != "" && stageIndex(name) < stageIndex(resumeFrom) {
+		log("Skipping the %s stage, resuming from %s", name, resumeFrom)
+		return nil
+	}
+
+	var selected []step
+	for _, s := range steps {
+		// -only and -skip could not select a step missing from generators
+		if !isGenerator(s.name()) {
+			return fmt.Errorf("step %q is not a known generator", s.desc)
+		}
+		if !generatorEnabled(s.name()) {
+			log("Skipping %s", s.desc)
+			continue
+		}
+		selected = append(selected, s)
+	}
+	steps = selected
+
+	limit := concurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	errs := make([]error, len(steps))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, s := range steps {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, s step) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			log("Creating %s", s.desc)
+			errs[i] = s.run()
+		}(i, s)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			log("Apply failed in the %s stage, once the cause is fixed it can be resumed with -resume-from=%s", name, name)
+			return fmt.Errorf("creating %s: %w", steps[i].desc, err)
+		}
+	}
+
+	return nil
+}
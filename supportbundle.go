@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// sensitiveKey matches config keys whose values are left out of support bundles.
+var sensitiveKey = regexp.MustCompile(`(?i)(password|secret|token|credential|key|license|htpasswd)`)
+
+// sensitiveValue matches htpasswd entries, which are redacted whatever their
+// key.
+var sensitiveValue = regexp.MustCompile(`(?m)^[^:\s]+:(\$(2[aby]|apr1|[156])\$|\{SHA\})`)
+
+// bundleWriter adds files to a gzipped tarball until the size limit is hit.
+// Files that would push the bundle over the limit are skipped, not truncated.
+type bundleWriter struct {
+	tw      *tar.Writer
+	written int64
+	limit   int64
+}
+
+func (b *bundleWriter) add(name string, data []byte) error {
+	if b.limit > 0 && b.written+int64(len(data)) > b.limit {
+		log("Skipping %s: bundle size limit reached", name)
+		return nil
+	}
+
+	err := b.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = b.tw.Write(data)
+	b.written += int64(len(data))
+
+	return err
+}
+
+func (b *bundleWriter) addYAML(name string, obj interface{}) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return b.add(name, data)
+}
+
+// writeSupportBundle implements `installer support-bundle`.
+func writeSupportBundle(ctx context.Context, client *kubernetes.Clientset, cfg *Config, args []string) error {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	output := fs.String("output", fmt.Sprintf("stackrox-support-%s.tar.gz", time.Now().Format("20060102-150405")), "file to write the bundle to")
+	maxSize := fs.Int64("max-size", 50*1024*1024, "maximum uncompressed size of the bundle in bytes, 0 for no limit")
+	logLines := fs.Int64("log-lines", 1000, "number of log lines to keep per container")
+	skip := fs.String("skip", "", "comma separated sections to leave out: config, resources, pods, events, logs, versions")
+	fs.Parse(args)
+
+	skipped := map[string]bool{}
+	for _, s := range strings.Split(*skip, ",") {
+		skipped[strings.TrimSpace(s)] = true
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	b := &bundleWriter{tw: tar.NewWriter(gz), limit: *maxSize}
+
+	if !skipped["versions"] {
+		log("Collecting versions")
+		err = collectVersions(ctx, client, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !skipped["config"] {
+		log("Collecting config")
+		err = collectConfig(cfg, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !skipped["resources"] {
+		log("Collecting resources")
+		err = collectResources(ctx, client, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !skipped["pods"] {
+		log("Collecting pod statuses")
+		for _, pod := range pods.Items {
+			err = b.addYAML("pods/"+pod.Name+".yaml", pod)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !skipped["events"] {
+		log("Collecting events")
+		events, err := client.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		err = b.addYAML("events.yaml", events.Items)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !skipped["logs"] {
+		log("Collecting logs")
+		for _, pod := range pods.Items {
+			for _, c := range pod.Spec.Containers {
+				err = collectLogs(ctx, client, b, pod.Name, c.Name, *logLines)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	err = b.tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+
+	log("Support bundle written to %s", *output)
+
+	return nil
+}
+
+// collectVersions records the installer, Kubernetes and deployed StackRox
+// versions. The images are read from the running pods, whose image IDs carry
+// the digests actually pulled.
+func collectVersions(ctx context.Context, client *kubernetes.Clientset, b *bundleWriter) error {
+	version, revision := installerVersion()
+	versions := map[string]interface{}{
+		"installer": map[string]string{
+			"version":      version,
+			"revision":     revision,
+			"configSchema": configSchemaVersion,
+		},
+	}
+	server, err := client.Discovery().ServerVersion()
+	if err != nil {
+		versions["kubernetesError"] = err.Error()
+	} else {
+		versions["kubernetes"] = server
+	}
+
+	images := map[string]interface{}{}
+	for _, app := range []string{"central", "central-db"} {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + app})
+		if err != nil {
+			images[app] = err.Error()
+			continue
+		}
+		var containers []map[string]string
+		for _, pod := range pods.Items {
+			for _, c := range pod.Status.ContainerStatuses {
+				containers = append(containers, map[string]string{
+					"pod":       pod.Name,
+					"container": c.Name,
+					"image":     c.Image,
+					"imageID":   c.ImageID,
+				})
+			}
+		}
+		images[app] = containers
+	}
+	versions["images"] = images
+
+	return b.addYAML("versions.yaml", versions)
+}
+
+// collectConfig stores the effective config with sensitive values replaced.
+func collectConfig(cfg *Config, b *bundleWriter) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	var generic map[string]interface{}
+	err = yaml.Unmarshal(data, &generic)
+	if err != nil {
+		return err
+	}
+	redact(generic)
+
+	return b.addYAML("config.yaml", generic)
+}
+
+func redact(m map[string]interface{}) {
+	for k, v := range m {
+		if sensitiveKey.MatchString(k) {
+			m[k] = "REDACTED"
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			if sensitiveValue.MatchString(v) {
+				m[k] = "REDACTED"
+			}
+		case map[string]interface{}:
+			redact(v)
+		case []interface{}:
+			for i, item := range v {
+				switch item := item.(type) {
+				case string:
+					if sensitiveValue.MatchString(item) {
+						v[i] = "REDACTED"
+					}
+				case map[string]interface{}:
+					redact(item)
+				}
+			}
+		}
+	}
+}
+
+func collectResources(ctx context.Context, client *kubernetes.Clientset, b *bundleWriter) error {
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	err = b.addYAML("resources/deployments.yaml", deployments.Items)
+	if err != nil {
+		return err
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	err = b.addYAML("resources/statefulsets.yaml", statefulSets.Items)
+	if err != nil {
+		return err
+	}
+
+	services, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	err = b.addYAML("resources/services.yaml", services.Items)
+	if err != nil {
+		return err
+	}
+
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	err = b.addYAML("resources/persistentvolumeclaims.yaml", pvcs.Items)
+	if err != nil {
+		return err
+	}
+
+	configMaps, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	err = b.addYAML("resources/configmaps.yaml", configMaps.Items)
+	if err != nil {
+		return err
+	}
+
+	// Never include secret contents, only which secrets and keys exist
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	secretKeys := map[string][]string{}
+	for _, s := range secrets.Items {
+		keys := []string{}
+		for k := range s.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		secretKeys[s.Name] = keys
+	}
+
+	return b.addYAML("resources/secrets.yaml", secretKeys)
+}
+
+func collectLogs(ctx context.Context, client *kubernetes.Clientset, b *bundleWriter, pod, container string, lines int64) error {
+	opts := v1.PodLogOptions{
+		Container: container,
+		TailLines: &lines,
+	}
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(pod, &opts).Stream(ctx)
+	if err != nil {
+		// A container that never started has no logs; note it and move on
+		return b.add(fmt.Sprintf("logs/%s/%s.log", pod, container), []byte(err.Error()+"\n"))
+	}
+	defer stream.Close()
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, stream)
+	if err != nil {
+		return err
+	}
+
+	return b.add(fmt.Sprintf("logs/%s/%s.log", pod, container), buf.Bytes())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// waitForDeployment blocks until the named deployment has rolled out its
+// current spec and every desired replica is available. A timeout of zero
+// disables waiting.
+func waitForDeployment(ctx context.Context, client *kubernetes.Clientset, name string, timeout time.Duration) error {
+	// Nothing was persisted, so there is nothing to become ready
+	if timeout == 0 || dryRun {
+		return nil
+	}
+
+	var details string
+	err := wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		deployment, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			details = "not found"
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		details = fmt.Sprintf("%d/%d updated, %d/%d available", deployment.Status.UpdatedReplicas, desired, deployment.Status.AvailableReplicas, desired)
+
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.UpdatedReplicas >= desired &&
+			deployment.Status.AvailableReplicas >= desired, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for deployment %s (%s): %w", name, details, err)
+	}
+
+	return nil
+}
+
+// waitForStatefulSet is waitForDeployment for StatefulSets.
+func waitForStatefulSet(ctx context.Context, client *kubernetes.Clientset, name string, timeout time.Duration) error {
+	if timeout == 0 || dryRun {
+		return nil
+	}
+
+	var details string
+	err := wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		sts, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			details = "not found"
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		desired := int32(1)
+		if sts.Spec.Replicas != nil {
+			desired = *sts.Spec.Replicas
+		}
+		details = fmt.Sprintf("%d/%d updated, %d/%d available", sts.Status.UpdatedReplicas, desired, sts.Status.AvailableReplicas, desired)
+
+		return sts.Status.ObservedGeneration >= sts.Generation &&
+			sts.Status.UpdatedReplicas >= desired &&
+			sts.Status.AvailableReplicas >= desired, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for statefulset %s (%s): %w", name, details, err)
+	}
+
+	return nil
+}